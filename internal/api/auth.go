@@ -0,0 +1,127 @@
+package api
+
+import "context"
+
+// DeviceLogin is returned from /api/auth/device when a device login starts.
+// The user approves it in a browser while the CLI polls with DeviceCode.
+type DeviceLogin struct {
+	Success                 bool   `json:"success"`
+	Error                   string `json:"error,omitempty"`
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURL         string `json:"verification_url"`
+	VerificationURLComplete string `json:"verification_url_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"` // Seconds
+	Interval                int    `json:"interval"`   // Seconds between polls
+}
+
+// Device login states reported by PollDeviceLogin
+const (
+	DeviceLoginPending  = "pending"
+	DeviceLoginApproved = "approved"
+	DeviceLoginDenied   = "denied"
+	DeviceLoginExpired  = "expired"
+)
+
+// DeviceTokenResponse from /api/auth/device/token
+type DeviceTokenResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Status  string `json:"status"`
+	APIKey  string `json:"api_key,omitempty"` // Set once Status is approved
+}
+
+// Account describes the logged-in user, from /api/me
+type Account struct {
+	Email  string        `json:"email"`
+	Name   string        `json:"name,omitempty"`
+	Plan   string        `json:"plan"`
+	Limits AccountLimits `json:"limits"`
+}
+
+// AccountLimits are the upload limits of an account's plan. Zero means unlimited.
+type AccountLimits struct {
+	MaxFileSize   int64 `json:"max_file_size"`
+	UploadsPerDay int   `json:"uploads_per_day"`
+	MaxExpiryDays int   `json:"max_expiry_days"`
+	StorageBytes  int64 `json:"storage_bytes"`
+}
+
+// MeResponse from /api/me
+type MeResponse struct {
+	Success bool     `json:"success"`
+	Error   string   `json:"error,omitempty"`
+	Account *Account `json:"account,omitempty"`
+}
+
+// StartDeviceLogin begins a device-code login
+func (c *Client) StartDeviceLogin(ctx context.Context) (*DeviceLogin, error) {
+	var resp DeviceLogin
+	if err := c.post(ctx, "/api/auth/device", map[string]string{"client": "cli"}, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, failure(resp.Error)
+	}
+	return &resp, nil
+}
+
+// PollDeviceLogin checks whether a device login has been approved
+func (c *Client) PollDeviceLogin(ctx context.Context, deviceCode string) (*DeviceTokenResponse, error) {
+	var resp DeviceTokenResponse
+	if err := c.postIdempotent(ctx, "/api/auth/device/token", map[string]string{"device_code": deviceCode}, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, failure(resp.Error)
+	}
+	return &resp, nil
+}
+
+// GetAccount returns the account the client's AuthToken belongs to
+func (c *Client) GetAccount(ctx context.Context) (*Account, error) {
+	var resp MeResponse
+	if err := c.get(ctx, "/api/me", &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, failure(resp.Error)
+	}
+	if resp.Account == nil {
+		return nil, failure("server response has no account")
+	}
+	return resp.Account, nil
+}
+
+// Quota is the upload allowance of the visitor token or account, from /api/quota
+type Quota struct {
+	Plan            string `json:"plan"` // "anonymous" without an account
+	UploadsPerDay   int    `json:"uploads_per_day"`
+	UploadsUsed     int    `json:"uploads_used"`
+	ResetsInSeconds int    `json:"resets_in_seconds"`
+	MaxFileSize     int64  `json:"max_file_size"`
+	StorageUsed     int64  `json:"storage_used,omitempty"`
+	StorageLimit    int64  `json:"storage_limit,omitempty"`
+}
+
+// QuotaResponse from /api/quota
+type QuotaResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Quota   *Quota `json:"quota,omitempty"`
+}
+
+// GetQuota returns today's upload allowance. It works without logging in.
+func (c *Client) GetQuota(ctx context.Context) (*Quota, error) {
+	var resp QuotaResponse
+	if err := c.get(ctx, "/api/quota", &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, failure(resp.Error)
+	}
+	if resp.Quota == nil {
+		return nil, failure("server response has no quota")
+	}
+	return resp.Quota, nil
+}
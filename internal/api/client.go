@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync/atomic"
 	"time"
 
+	"github.com/storageto/cli/internal/retry"
 	"github.com/storageto/cli/internal/version"
 )
 
@@ -16,8 +21,23 @@ import (
 type Client struct {
 	BaseURL      string
 	VisitorToken string
-	HTTPClient   *http.Client
-}
+	// AuthToken is an account API key. When set, requests are made on
+	// behalf of the account instead of anonymously.
+	AuthToken string
+	// SharePassword unlocks password-protected files and collections
+	SharePassword string
+	// RateLimitWait, if set, is called when a request is rate limited. The
+	// request is retried if it returns nil, otherwise its error is returned.
+	RateLimitWait func(ctx context.Context, err *Error) error
+	// Retry retries requests that failed in transit or with a retryable
+	// Error. The zero value doesn't retry.
+	Retry      retry.Policy
+	HTTPClient *http.Client
+}
+
+// SharePasswordHeader carries Client.SharePassword. Downloads of raw files
+// must send it too.
+const SharePasswordHeader = "X-Share-Password"
 
 // NewClient creates a new API client
 func NewClient(baseURL string, visitorToken string) *Client {
@@ -30,11 +50,31 @@ func NewClient(baseURL string, visitorToken string) *Client {
 	}
 }
 
+// ShareOptions restrict access to an upload. The zero value leaves
+// everything to the server's defaults.
+type ShareOptions struct {
+	// ExpiresAt is an RFC 3339 timestamp
+	ExpiresAt     string `json:"expires_at,omitempty"`
+	MaxDownloads  int    `json:"max_downloads,omitempty"`
+	BurnAfterRead bool   `json:"burn_after_read,omitempty"`
+}
+
 // InitUploadRequest is sent to /api/upload/init
 type InitUploadRequest struct {
 	Filename    string `json:"filename"`
 	ContentType string `json:"content_type"`
 	Size        int64  `json:"size"`
+	// Streaming requests a multipart upload of unknown size (Size is ignored).
+	// TotalParts is 0 in the response; part URLs are fetched as data arrives.
+	Streaming bool `json:"streaming,omitempty"`
+	// ChecksumAlgorithm asks for upload URLs that accept the matching
+	// x-amz-checksum-* header, e.g. "sha256"
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+	// PartSize asks for multipart parts of this many bytes. The server may
+	// adjust it, e.g. to stay within the part count limit; the size in
+	// effect is the PartSize of the response. Zero lets the server choose.
+	PartSize int64 `json:"part_size,omitempty"`
+	ShareOptions
 }
 
 // InitUploadResponse from /api/upload/init
@@ -89,6 +129,19 @@ type ConfirmUploadRequest struct {
 	ContentType  string `json:"content_type"`
 	R2Key        string `json:"r2_key"`
 	CollectionID string `json:"collection_id,omitempty"`
+	// Password protects the file. Files in a collection use the
+	// collection's password instead.
+	Password string `json:"password,omitempty"`
+	Digest
+	ShareOptions
+}
+
+// Digest is a checksum of an upload's stored bytes computed by the client,
+// so the server can prove they arrived intact
+type Digest struct {
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+	// Checksum is hex encoded
+	Checksum string `json:"checksum,omitempty"`
 }
 
 // ConfirmUploadResponse from /api/upload/confirm
@@ -107,11 +160,25 @@ type FileInfo struct {
 	Size      int64  `json:"size"`
 	HumanSize string `json:"human_size"`
 	ExpiresAt string `json:"expires_at"`
+	// Description is an optional note shown on the file page
+	Description string `json:"description,omitempty"`
+	// ContentType and DownloadCount are only included by GetFile and
+	// collection manifests
+	ContentType   string `json:"content_type,omitempty"`
+	DownloadCount int    `json:"download_count,omitempty"`
+	// Set when the upload was restricted with ShareOptions
+	MaxDownloads      int  `json:"max_downloads,omitempty"`
+	BurnAfterRead     bool `json:"burn_after_read,omitempty"`
+	PasswordProtected bool `json:"password_protected,omitempty"`
+	// Set when the upload was confirmed with a Digest
+	Digest
 }
 
 // CreateCollectionRequest for /api/collection
 type CreateCollectionRequest struct {
-	ExpectedFileCount int `json:"expected_file_count,omitempty"`
+	ExpectedFileCount int    `json:"expected_file_count,omitempty"`
+	Password          string `json:"password,omitempty"`
+	ShareOptions
 }
 
 // CreateCollectionResponse from /api/collection
@@ -123,9 +190,10 @@ type CreateCollectionResponse struct {
 
 // CollectionInfo contains information about a collection
 type CollectionInfo struct {
-	ID        string `json:"id"`
-	URL       string `json:"url"`
-	ExpiresAt string `json:"expires_at"`
+	ID                string `json:"id"`
+	URL               string `json:"url"`
+	ExpiresAt         string `json:"expires_at"`
+	PasswordProtected bool   `json:"password_protected,omitempty"`
 }
 
 // MarkCollectionReadyResponse from /api/collection/{id}/ready
@@ -135,6 +203,21 @@ type MarkCollectionReadyResponse struct {
 	Collection *CollectionInfo `json:"collection,omitempty"`
 }
 
+// GetFileResponse from /api/file/{id}
+type GetFileResponse struct {
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+	File    *FileInfo `json:"file,omitempty"`
+}
+
+// CollectionManifest is the public manifest served at /c/{id}.json
+type CollectionManifest struct {
+	ID        string     `json:"id"`
+	URL       string     `json:"url"`
+	ExpiresAt string     `json:"expires_at"`
+	Files     []FileInfo `json:"files"`
+}
+
 // Batch upload types
 
 // BatchFileRequest represents a single file in a batch init request
@@ -147,6 +230,10 @@ type BatchFileRequest struct {
 // InitBatchRequest for /api/upload/init-batch
 type InitBatchRequest struct {
 	Files []BatchFileRequest `json:"files"`
+	// ChecksumAlgorithm and PartSize are as in InitUploadRequest
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+	PartSize          int64  `json:"part_size,omitempty"`
+	ShareOptions
 }
 
 // InitBatchResult represents the init result for a single file
@@ -175,12 +262,14 @@ type BatchConfirmFile struct {
 	Size        int64  `json:"size"`
 	ContentType string `json:"content_type"`
 	R2Key       string `json:"r2_key"`
+	Digest
 }
 
 // ConfirmBatchRequest for /api/upload/confirm-batch
 type ConfirmBatchRequest struct {
 	CollectionID string             `json:"collection_id,omitempty"`
 	Files        []BatchConfirmFile `json:"files"`
+	ShareOptions
 }
 
 // ConfirmBatchResult represents the confirm result for a single file
@@ -204,7 +293,7 @@ func (c *Client) InitUpload(ctx context.Context, req *InitUploadRequest) (*InitU
 		return nil, err
 	}
 	if !resp.Success {
-		return nil, fmt.Errorf("%s", resp.Error)
+		return nil, failure(resp.Error)
 	}
 	return &resp, nil
 }
@@ -212,11 +301,11 @@ func (c *Client) InitUpload(ctx context.Context, req *InitUploadRequest) (*InitU
 // GetPartURLs gets presigned URLs for additional parts
 func (c *Client) GetPartURLs(ctx context.Context, req *GetPartURLsRequest) (*GetPartURLsResponse, error) {
 	var resp GetPartURLsResponse
-	if err := c.post(ctx, "/api/upload/parts", req, &resp); err != nil {
+	if err := c.postIdempotent(ctx, "/api/upload/parts", req, &resp); err != nil {
 		return nil, err
 	}
 	if !resp.Success {
-		return nil, fmt.Errorf("%s", resp.Error)
+		return nil, failure(resp.Error)
 	}
 	return &resp, nil
 }
@@ -228,7 +317,7 @@ func (c *Client) CompleteMultipart(ctx context.Context, req *CompleteMultipartRe
 		return nil, err
 	}
 	if !resp.Success {
-		return nil, fmt.Errorf("%s", resp.Error)
+		return nil, failure(resp.Error)
 	}
 	return &resp, nil
 }
@@ -240,7 +329,7 @@ func (c *Client) ConfirmUpload(ctx context.Context, req *ConfirmUploadRequest) (
 		return nil, err
 	}
 	if !resp.Success {
-		return nil, fmt.Errorf("%s", resp.Error)
+		return nil, failure(resp.Error)
 	}
 	return &resp, nil
 }
@@ -252,7 +341,7 @@ func (c *Client) CreateCollection(ctx context.Context, req *CreateCollectionRequ
 		return nil, err
 	}
 	if !resp.Success {
-		return nil, fmt.Errorf("%s", resp.Error)
+		return nil, failure(resp.Error)
 	}
 	return &resp, nil
 }
@@ -263,12 +352,12 @@ func (c *Client) AbortUpload(ctx context.Context, uploadID string) error {
 		Success bool   `json:"success"`
 		Error   string `json:"error,omitempty"`
 	}
-	err := c.post(ctx, "/api/upload/abort", map[string]string{"upload_id": uploadID}, &resp)
+	err := c.postIdempotent(ctx, "/api/upload/abort", map[string]string{"upload_id": uploadID}, &resp)
 	if err != nil {
 		return err
 	}
 	if !resp.Success {
-		return fmt.Errorf("%s", resp.Error)
+		return failure(resp.Error)
 	}
 	return nil
 }
@@ -276,11 +365,11 @@ func (c *Client) AbortUpload(ctx context.Context, uploadID string) error {
 // MarkCollectionReady marks a collection as ready
 func (c *Client) MarkCollectionReady(ctx context.Context, collectionID string) (*MarkCollectionReadyResponse, error) {
 	var resp MarkCollectionReadyResponse
-	if err := c.post(ctx, fmt.Sprintf("/api/collection/%s/ready", collectionID), struct{}{}, &resp); err != nil {
+	if err := c.postIdempotent(ctx, fmt.Sprintf("/api/collection/%s/ready", collectionID), struct{}{}, &resp); err != nil {
 		return nil, err
 	}
 	if !resp.Success {
-		return nil, fmt.Errorf("%s", resp.Error)
+		return nil, failure(resp.Error)
 	}
 	return &resp, nil
 }
@@ -292,7 +381,7 @@ func (c *Client) InitUploadBatch(ctx context.Context, req *InitBatchRequest) (*I
 		return nil, err
 	}
 	if !resp.Success {
-		return nil, fmt.Errorf("%s", resp.Error)
+		return nil, failure(resp.Error)
 	}
 	return &resp, nil
 }
@@ -304,35 +393,188 @@ func (c *Client) ConfirmUploadBatch(ctx context.Context, req *ConfirmBatchReques
 		return nil, err
 	}
 	if !resp.Success {
-		return nil, fmt.Errorf("%s", resp.Error)
+		return nil, failure(resp.Error)
 	}
 	return &resp, nil
 }
 
+// UploadExistsRequest for /api/upload/exists
+type UploadExistsRequest struct {
+	// Hashes are hex SHA-256 digests of file contents
+	Hashes []string `json:"hashes"`
+}
+
+// ExistingUpload is stored content a new file can be confirmed with
+// instead of uploading the same bytes again
+type ExistingUpload struct {
+	R2Key string `json:"r2_key"`
+	Size  int64  `json:"size"`
+}
+
+// UploadExistsResponse from /api/upload/exists
+type UploadExistsResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Existing holds the hashes the server already has content for.
+	// Only content uploaded by the same visitor or account is reported.
+	Existing map[string]ExistingUpload `json:"existing,omitempty"`
+}
+
+// UploadExists looks up previously uploaded content by hash
+func (c *Client) UploadExists(ctx context.Context, req *UploadExistsRequest) (*UploadExistsResponse, error) {
+	var resp UploadExistsResponse
+	if err := c.postIdempotent(ctx, "/api/upload/exists", req, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, failure(resp.Error)
+	}
+	return &resp, nil
+}
+
+// GetFile fetches information about an uploaded file
+func (c *Client) GetFile(ctx context.Context, id string) (*GetFileResponse, error) {
+	var resp GetFileResponse
+	if err := c.get(ctx, "/api/file/"+url.PathEscape(id), &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, failure(resp.Error)
+	}
+	if resp.File == nil {
+		return nil, failure("server response has no file")
+	}
+	return &resp, nil
+}
+
+// GetCollectionManifest fetches the public manifest of a collection
+func (c *Client) GetCollectionManifest(ctx context.Context, id string) (*CollectionManifest, error) {
+	var manifest CollectionManifest
+	if err := c.get(ctx, "/c/"+url.PathEscape(id)+".json", &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// post sends a request that must not be repeated once the server may have
+// acted on it, e.g. because it creates something. It is only retried when
+// it was rate limited or could not be sent at all.
 func (c *Client) post(ctx context.Context, path string, body interface{}, result interface{}) error {
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return fmt.Errorf("failed to encode request: %w", err)
+	return c.do(ctx, "POST", path, body, result, false)
+}
+
+// postIdempotent sends a POST request that has the same effect no matter
+// how often the server handles it
+func (c *Client) postIdempotent(ctx context.Context, path string, body interface{}, result interface{}) error {
+	return c.do(ctx, "POST", path, body, result, true)
+}
+
+func (c *Client) get(ctx context.Context, path string, result interface{}) error {
+	return c.do(ctx, "GET", path, nil, result, true)
+}
+
+func (c *Client) patch(ctx context.Context, path string, body interface{}, result interface{}) error {
+	return c.do(ctx, "PATCH", path, body, result, true)
+}
+
+func (c *Client) delete(ctx context.Context, path string, result interface{}) error {
+	return c.do(ctx, "DELETE", path, nil, result, true)
+}
+
+// do sends a request under the retry policy. Requests that are not
+// idempotent are only retried if the server can't have handled them.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, result interface{}, idempotent bool) error {
+	var jsonBody []byte
+	if body != nil {
+		var err error
+		jsonBody, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	return c.Retry.Do(ctx, func() error {
+		for {
+			err := c.send(ctx, method, path, jsonBody, result)
+			if err == nil || retry.IsPermanent(err) {
+				return err
+			}
+			apiErr, ok := err.(*Error)
+			if !ok {
+				var unsent *unsentError
+				if !idempotent && !errors.As(err, &unsent) {
+					return retry.Permanent(err)
+				}
+				return err
+			}
+			if apiErr.Code == CodeRateLimited && c.RateLimitWait != nil {
+				if waitErr := c.RateLimitWait(ctx, apiErr); waitErr != nil {
+					return retry.Permanent(waitErr)
+				}
+				continue
+			}
+			// A rate limited request was turned away before being handled
+			if !apiErr.Retryable || !idempotent && apiErr.Code != CodeRateLimited {
+				return retry.Permanent(err)
+			}
+			return err
+		}
+	})
+}
+
+// unsentError is a transport error that happened before the request was
+// completely written, so the server can't have acted on it
+type unsentError struct {
+	err error
+}
+
+func (e *unsentError) Error() string { return e.err.Error() }
+func (e *unsentError) Unwrap() error { return e.err }
+
+func (c *Client) send(ctx context.Context, method, path string, jsonBody []byte, result interface{}) error {
+	var reqBody io.Reader
+	if jsonBody != nil {
+		reqBody = bytes.NewReader(jsonBody)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+path, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reqBody)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return retry.Permanent(fmt.Errorf("failed to create request: %w", err))
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	if jsonBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("User-Agent", version.UserAgent())
 	if c.VisitorToken != "" {
 		req.Header.Set("X-Visitor-Token", c.VisitorToken)
 	}
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+	if c.SharePassword != "" {
+		req.Header.Set(SharePasswordHeader, c.SharePassword)
+	}
+
+	// The transport reports from its own goroutine when the request is out
+	var sent atomic.Bool
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			sent.Store(info.Err == nil)
+		},
+	}))
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
 		if ctx.Err() == context.Canceled {
 			return fmt.Errorf("request cancelled")
 		}
-		return fmt.Errorf("request failed: %w", err)
+		err = fmt.Errorf("request failed: %w", err)
+		if !sent.Load() {
+			return &unsentError{err}
+		}
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -341,39 +583,18 @@ func (c *Client) post(ctx context.Context, path string, body interface{}, result
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode == 429 {
-		// Try to parse the rate limit response
-		var rateLimitResp struct {
-			Error          string `json:"error"`
-			Limit          int    `json:"limit"`
-			Used           int    `json:"used"`
-			ResetsInSeconds int   `json:"resets_in_seconds"`
-		}
-		if json.Unmarshal(respBody, &rateLimitResp) == nil && rateLimitResp.Error != "" {
-			return fmt.Errorf("%s", rateLimitResp.Error)
-		}
-		return fmt.Errorf("rate limited - please try again later")
+	if resp.StatusCode >= 400 {
+		return parseError(resp.StatusCode, resp.Header, respBody)
 	}
 
-	if resp.StatusCode >= 400 {
-		// Try to extract error message from JSON response
-		var errResp struct {
-			Error   string `json:"error"`
-			Message string `json:"message"`
-		}
-		if json.Unmarshal(respBody, &errResp) == nil {
-			if errResp.Error != "" {
-				return fmt.Errorf("%s", errResp.Error)
-			}
-			if errResp.Message != "" {
-				return fmt.Errorf("%s", errResp.Message)
-			}
-		}
-		return fmt.Errorf("server error (HTTP %d)", resp.StatusCode)
+	// Some endpoints report failures with a success status
+	var eb errorBody
+	if json.Unmarshal(respBody, &eb) == nil && eb.Success != nil && !*eb.Success {
+		return parseError(0, resp.Header, respBody)
 	}
 
 	if err := json.Unmarshal(respBody, result); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+		return retry.Permanent(fmt.Errorf("failed to parse response: %w", err))
 	}
 
 	return nil
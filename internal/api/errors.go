@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error codes reported in Error.Code. The server sends its own codes; when
+// it doesn't, one is derived from the HTTP status.
+const (
+	CodeRateLimited      = "rate_limited"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodeFileTooLarge     = "file_too_large"
+	CodeNotFound         = "not_found"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodePasswordRequired = "password_required"
+	CodeServerError      = "server_error"
+)
+
+// Error is returned for requests the server rejected. Use errors.As to
+// inspect it through wrapped errors.
+type Error struct {
+	// StatusCode is the HTTP status. It is 0 when the server answered
+	// successfully but reported a failure in the response body.
+	StatusCode int
+	Code       string
+	Message    string
+	// Retryable is set when the same request may succeed later
+	Retryable bool
+
+	// Rate limit details, set when Code is CodeRateLimited
+	Limit    int
+	Used     int
+	ResetsIn time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Code == CodeRateLimited {
+		return "rate limited - please try again later"
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("server error (HTTP %d)", e.StatusCode)
+	}
+	return "request failed"
+}
+
+// RetryAfter returns how long the server asked to wait before trying again,
+// from resets_in_seconds or the Retry-After header
+func (e *Error) RetryAfter() time.Duration {
+	return e.ResetsIn
+}
+
+// errorBody is the JSON error payload of the API
+type errorBody struct {
+	Success         *bool  `json:"success"`
+	Error           string `json:"error"`
+	Message         string `json:"message"`
+	Code            string `json:"code"`
+	Limit           int    `json:"limit"`
+	Used            int    `json:"used"`
+	ResetsInSeconds int    `json:"resets_in_seconds"`
+}
+
+// ErrorFromResponse builds an Error from a failed response whose body has
+// already been read, e.g. for downloads made outside the Client
+func ErrorFromResponse(resp *http.Response, body []byte) *Error {
+	return parseError(resp.StatusCode, resp.Header, body)
+}
+
+// parseError builds an Error from a failed response
+func parseError(status int, header http.Header, body []byte) *Error {
+	var eb errorBody
+	json.Unmarshal(body, &eb)
+
+	e := &Error{
+		StatusCode: status,
+		Code:       eb.Code,
+		Message:    eb.Error,
+		Limit:      eb.Limit,
+		Used:       eb.Used,
+		ResetsIn:   time.Duration(eb.ResetsInSeconds) * time.Second,
+	}
+	if e.Message == "" {
+		e.Message = eb.Message
+	}
+	if e.Code == "" {
+		e.Code = codeForStatus(status)
+	}
+	if e.ResetsIn == 0 {
+		if secs, err := strconv.Atoi(header.Get("Retry-After")); err == nil && secs > 0 {
+			e.ResetsIn = time.Duration(secs) * time.Second
+		}
+	}
+
+	switch {
+	case e.Code == CodeRateLimited:
+		e.Retryable = true
+	case status == http.StatusRequestTimeout, status >= 500 && status != http.StatusNotImplemented:
+		e.Retryable = true
+	}
+	return e
+}
+
+func codeForStatus(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return CodeRateLimited
+	case status == http.StatusRequestEntityTooLarge:
+		return CodeFileTooLarge
+	case status == http.StatusNotFound, status == http.StatusGone:
+		return CodeNotFound
+	case status == http.StatusUnauthorized:
+		return CodeUnauthorized
+	case status == http.StatusForbidden:
+		return CodeForbidden
+	case status >= 500:
+		return CodeServerError
+	}
+	return ""
+}
+
+// failure is returned by Client methods when a response reports
+// "success": false without an error status
+func failure(message string) error {
+	return &Error{Message: message}
+}
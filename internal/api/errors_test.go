@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/storageto/cli/internal/retry"
+)
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		header    map[string]string
+		body      string
+		code      string
+		message   string
+		retryable bool
+	}{
+		{"rate limit payload", 429, nil, `{"error":"Daily limit reached","limit":20,"used":20,"resets_in_seconds":3600}`, CodeRateLimited, "Daily limit reached", true},
+		{"server code wins", 403, nil, `{"error":"Plan quota exceeded","code":"quota_exceeded"}`, CodeQuotaExceeded, "Plan quota exceeded", false},
+		{"code from status", 413, nil, `{"message":"File too large"}`, CodeFileTooLarge, "File too large", false},
+		{"not found", 404, nil, `not json`, CodeNotFound, "server error (HTTP 404)", false},
+		{"retry after", 503, map[string]string{"Retry-After": "30"}, ``, CodeServerError, "server error (HTTP 503)", true},
+		{"success false", 200, nil, `{"success":false,"error":"Upload expired","code":"expired"}`, "expired", "Upload expired", false},
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range tt.header {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, tt.body)
+		}))
+
+		_, err := NewClient(srv.URL, "").GetFile(context.Background(), "FQxyz1234")
+		srv.Close()
+
+		var apiErr *Error
+		if !errors.As(fmt.Errorf("wrapped: %w", err), &apiErr) {
+			t.Errorf("%s: error %v is not an *Error", tt.name, err)
+			continue
+		}
+		if apiErr.Code != tt.code || apiErr.Error() != tt.message || apiErr.Retryable != tt.retryable {
+			t.Errorf("%s: got code %q, message %q, retryable %v; want %q, %q, %v",
+				tt.name, apiErr.Code, apiErr.Error(), apiErr.Retryable, tt.code, tt.message, tt.retryable)
+		}
+		if tt.status == 429 && (apiErr.Limit != 20 || apiErr.Used != 20 || apiErr.ResetsIn != time.Hour) {
+			t.Errorf("%s: rate limit fields = %d/%d, %v", tt.name, apiErr.Used, apiErr.Limit, apiErr.ResetsIn)
+		}
+		if tt.header["Retry-After"] != "" && apiErr.ResetsIn != 30*time.Second {
+			t.Errorf("%s: ResetsIn = %v, want 30s from Retry-After", tt.name, apiErr.ResetsIn)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		calls  int
+	}{
+		{"server error is retried", 503, 2},
+		{"not found is permanent", 404, 1},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(tt.status)
+				return
+			}
+			fmt.Fprint(w, `{"success":true,"file":{"id":"FQxyz1234"}}`)
+		}))
+
+		client := NewClient(srv.URL, "")
+		client.Retry = retry.Policy{Attempts: 3, BaseDelay: time.Millisecond}
+		_, err := client.GetFile(context.Background(), "FQxyz1234")
+		srv.Close()
+
+		if calls != tt.calls {
+			t.Errorf("%s: %d requests, want %d", tt.name, calls, tt.calls)
+		}
+		if (err == nil) != (tt.calls > 1) {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+	}
+}
+
+func TestRetryPost(t *testing.T) {
+	tests := []struct {
+		name  string
+		fail  func(w http.ResponseWriter)
+		calls int
+	}{
+		{"server error", func(w http.ResponseWriter) { w.WriteHeader(503) }, 1},
+		{"rate limited", func(w http.ResponseWriter) { w.WriteHeader(429) }, 2},
+		{"connection lost after sending", func(w http.ResponseWriter) {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}, 1},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				tt.fail(w)
+				return
+			}
+			fmt.Fprint(w, `{"success":true,"collection":{"id":"C1"}}`)
+		}))
+
+		client := NewClient(srv.URL, "")
+		client.Retry = retry.Policy{Attempts: 3, BaseDelay: time.Millisecond}
+		_, err := client.CreateCollection(context.Background(), &CreateCollectionRequest{})
+		srv.Close()
+
+		if calls != tt.calls {
+			t.Errorf("%s: %d requests, want %d", tt.name, calls, tt.calls)
+		}
+		if (err == nil) != (tt.calls > 1) {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+	}
+}
+
+// failFirst is a transport that fails its first request without sending it
+type failFirst struct {
+	failed bool
+}
+
+func (f *failFirst) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !f.failed {
+		f.failed = true
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRetryPostNotSent(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, `{"success":true,"collection":{"id":"C1"}}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, "")
+	client.HTTPClient.Transport = &failFirst{}
+	client.Retry = retry.Policy{Attempts: 3, BaseDelay: time.Millisecond}
+	if _, err := client.CreateCollection(context.Background(), &CreateCollectionRequest{}); err != nil {
+		t.Errorf("CreateCollection() error = %v, want it retried", err)
+	}
+	if calls != 1 {
+		t.Errorf("server got %d requests, want 1", calls)
+	}
+}
+
+func TestMissingResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"success":true}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, "")
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"GetFile", func() error {
+			_, err := client.GetFile(context.Background(), "FQxyz1234")
+			return err
+		}},
+		{"GetAccount", func() error {
+			_, err := client.GetAccount(context.Background())
+			return err
+		}},
+		{"GetQuota", func() error {
+			_, err := client.GetQuota(context.Background())
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); err == nil {
+			t.Errorf("%s() succeeded without a result, want error", tt.name)
+		}
+	}
+}
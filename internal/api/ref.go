@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RefKind says whether a Ref points at a file or a collection
+type RefKind int
+
+const (
+	RefFile RefKind = iota
+	RefCollection
+)
+
+// Ref identifies a file or collection on storage.to
+type Ref struct {
+	Kind RefKind
+	ID   string
+	// Key is the encryption key from a "#k=<key>" URL fragment, if any.
+	// Fragments never reach the server.
+	Key string
+}
+
+// ParseRef resolves any of the link shapes storage.to hands out into a Ref:
+//
+//	https://storage.to/<id>        file page
+//	https://storage.to/r/<id>      raw file
+//	https://storage.to/c/<id>      collection page
+//	https://storage.to/c/<id>.json collection manifest
+//	<id>, r/<id>, c/<id>           the same without scheme and host
+//
+// Any of these may carry a "#k=<key>" fragment for encrypted uploads.
+func ParseRef(s string) (Ref, error) {
+	p := strings.TrimSpace(s)
+	var fragment string
+	if strings.Contains(p, "://") {
+		u, err := url.Parse(p)
+		if err != nil {
+			return Ref{}, fmt.Errorf("invalid URL %q: %w", s, err)
+		}
+		p = u.Path
+		fragment = u.Fragment
+	} else {
+		if i := strings.Index(p, "#"); i >= 0 {
+			fragment = p[i+1:]
+			p = p[:i]
+		}
+		if i := strings.Index(p, "?"); i >= 0 {
+			p = p[:i]
+		}
+	}
+	p = strings.Trim(p, "/")
+
+	ref := Ref{Kind: RefFile}
+	if values, err := url.ParseQuery(fragment); err == nil {
+		ref.Key = values.Get("k")
+	}
+	switch {
+	case strings.HasPrefix(p, "c/"):
+		ref.Kind = RefCollection
+		p = strings.TrimSuffix(strings.TrimPrefix(p, "c/"), ".json")
+	case strings.HasPrefix(p, "r/"):
+		p = strings.TrimPrefix(p, "r/")
+	}
+
+	if !validID(p) {
+		return Ref{}, fmt.Errorf("not a storage.to link or ID: %q", s)
+	}
+	ref.ID = p
+	return ref, nil
+}
+
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package api
+
+import "testing"
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Ref
+	}{
+		{"FQxyz1234", Ref{Kind: RefFile, ID: "FQxyz1234"}},
+		{"https://storage.to/FQxyz1234", Ref{Kind: RefFile, ID: "FQxyz1234"}},
+		{"https://storage.to/r/FQxyz1234", Ref{Kind: RefFile, ID: "FQxyz1234"}},
+		{"https://storage.to/c/FQabc5678", Ref{Kind: RefCollection, ID: "FQabc5678"}},
+		{"https://storage.to/c/FQabc5678.json", Ref{Kind: RefCollection, ID: "FQabc5678"}},
+		{"c/FQabc5678", Ref{Kind: RefCollection, ID: "FQabc5678"}},
+		{"r/FQxyz1234/", Ref{Kind: RefFile, ID: "FQxyz1234"}},
+		{"https://storage.to/FQxyz1234#k=secret", Ref{Kind: RefFile, ID: "FQxyz1234", Key: "secret"}},
+		{"c/FQabc5678#k=secret", Ref{Kind: RefCollection, ID: "FQabc5678", Key: "secret"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRef(tt.input)
+		if err != nil {
+			t.Errorf("ParseRef(%q) error = %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRef(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "https://storage.to/", "a/b/c", "../etc"} {
+		if _, err := ParseRef(bad); err == nil {
+			t.Errorf("ParseRef(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// ListUploadsOptions selects what ListUploads returns
+type ListUploadsOptions struct {
+	Collections bool // List collections instead of files
+	Expired     bool // Include expired uploads
+	Limit       int  // Maximum number of entries; 0 uses the server default
+}
+
+// UploadEntry is a file in the upload listing
+type UploadEntry struct {
+	FileInfo
+	CreatedAt string `json:"created_at"`
+	Expired   bool   `json:"expired,omitempty"`
+}
+
+// CollectionEntry is a collection in the upload listing
+type CollectionEntry struct {
+	CollectionInfo
+	FileCount int    `json:"file_count"`
+	Size      int64  `json:"size"`
+	HumanSize string `json:"human_size"`
+	CreatedAt string `json:"created_at"`
+	Expired   bool   `json:"expired,omitempty"`
+}
+
+// ListUploadsResponse from /api/uploads
+type ListUploadsResponse struct {
+	Success     bool              `json:"success"`
+	Error       string            `json:"error,omitempty"`
+	Files       []UploadEntry     `json:"files,omitempty"`
+	Collections []CollectionEntry `json:"collections,omitempty"`
+}
+
+// ListUploads returns recent uploads of the visitor token or account,
+// newest first
+func (c *Client) ListUploads(ctx context.Context, opts ListUploadsOptions) (*ListUploadsResponse, error) {
+	query := url.Values{}
+	if opts.Collections {
+		query.Set("type", "collections")
+	} else {
+		query.Set("type", "files")
+	}
+	if opts.Expired {
+		query.Set("expired", "1")
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var resp ListUploadsResponse
+	if err := c.get(ctx, "/api/uploads?"+query.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, failure(resp.Error)
+	}
+	return &resp, nil
+}
+
+// DeleteFile deletes an uploaded file. Its links stop working immediately.
+func (c *Client) DeleteFile(ctx context.Context, id string) error {
+	return c.deleteUpload(ctx, "/api/file/"+url.PathEscape(id))
+}
+
+// DeleteCollection deletes a collection together with its files
+func (c *Client) DeleteCollection(ctx context.Context, id string) error {
+	return c.deleteUpload(ctx, "/api/collection/"+url.PathEscape(id))
+}
+
+func (c *Client) deleteUpload(ctx context.Context, path string) error {
+	var resp struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error,omitempty"`
+	}
+	if err := c.delete(ctx, path, &resp); err != nil {
+		return err
+	}
+	if !resp.Success {
+		return failure(resp.Error)
+	}
+	return nil
+}
+
+// UpdateRequest for PATCH /api/file/{id} and /api/collection/{id}. Nil
+// fields are left unchanged.
+type UpdateRequest struct {
+	Filename    *string `json:"filename,omitempty"`
+	Description *string `json:"description,omitempty"`
+	// ExpiresAt is an RFC 3339 timestamp
+	ExpiresAt *string `json:"expires_at,omitempty"`
+	// CollectionID adds a file to an existing collection
+	CollectionID *string `json:"collection_id,omitempty"`
+}
+
+// UpdateFileResponse from PATCH /api/file/{id}
+type UpdateFileResponse struct {
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+	File    *FileInfo `json:"file,omitempty"`
+}
+
+// UpdateCollectionResponse from PATCH /api/collection/{id}
+type UpdateCollectionResponse struct {
+	Success    bool            `json:"success"`
+	Error      string          `json:"error,omitempty"`
+	Collection *CollectionInfo `json:"collection,omitempty"`
+}
+
+// UpdateFile changes the metadata of an uploaded file
+func (c *Client) UpdateFile(ctx context.Context, id string, req *UpdateRequest) (*FileInfo, error) {
+	var resp UpdateFileResponse
+	if err := c.patch(ctx, "/api/file/"+url.PathEscape(id), req, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, failure(resp.Error)
+	}
+	if resp.File == nil {
+		return nil, failure("server response has no file")
+	}
+	return resp.File, nil
+}
+
+// UpdateCollection changes the metadata of a collection
+func (c *Client) UpdateCollection(ctx context.Context, id string, req *UpdateRequest) (*CollectionInfo, error) {
+	var resp UpdateCollectionResponse
+	if err := c.patch(ctx, "/api/collection/"+url.PathEscape(id), req, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, failure(resp.Error)
+	}
+	if resp.Collection == nil {
+		return nil, failure("server response has no collection")
+	}
+	return resp.Collection, nil
+}
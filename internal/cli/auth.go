@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/config"
+	"github.com/storageto/cli/internal/progress"
+)
+
+var loginAPIKey string
+
+// loginSecond is the unit of the waits in a device login. It is a variable
+// so tests can shorten it.
+var loginSecond = time.Second
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to your storage.to account",
+	Long: `Log in to use your account's limits instead of anonymous ones.
+
+By default a code is shown that you confirm in the browser. For CI and
+other non-interactive use, pass an API key from your account settings
+with --api-key ("-" reads it from stdin), or set STORAGETO_API_KEY
+instead of logging in.
+
+Credentials are stored in the config directory, readable only by you.`,
+	Args: cobra.NoArgs,
+	RunE: runLogin,
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove stored account credentials",
+	Args:  cobra.NoArgs,
+	RunE:  runLogout,
+}
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the logged-in account, plan and limits",
+	Args:  cobra.NoArgs,
+	RunE:  runWhoami,
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd, logoutCmd, whoamiCmd)
+	loginCmd.Flags().StringVar(&loginAPIKey, "api-key", "", "Log in with an API key instead of the browser (- reads stdin)")
+	whoamiCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output result as JSON")
+}
+
+func runLogin(cmd *cobra.Command, args []string) error {
+	display := messageDisplay()
+	defer display.Stop()
+
+	ctx, cancel := signalContext(display, "Cancelling login...")
+	defer cancel()
+
+	// The visitor token lets the server attach earlier anonymous uploads
+	// from this machine to the account
+	var visitorToken string
+	if !noToken {
+		var err error
+		if visitorToken, err = config.GetVisitorToken(); err != nil {
+			return fmt.Errorf("failed to initialize: %w", err)
+		}
+	}
+	client := api.NewClient(apiURL, visitorToken)
+
+	apiKey := loginAPIKey
+	if apiKey == "-" {
+		// Keeps the key out of shell history and process listings
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, 4096))
+		if err != nil {
+			return fmt.Errorf("failed to read API key: %w", err)
+		}
+		apiKey = strings.TrimSpace(string(data))
+	}
+	if apiKey == "" {
+		var err error
+		apiKey, err = deviceLogin(ctx, client, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check the key works before storing it
+	client.AuthToken = apiKey
+	account, err := client.GetAccount(ctx)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+
+	if err := config.SaveCredentials(&config.Credentials{
+		APIKey:    apiKey,
+		Email:     account.Email,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to save credentials: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Logged in as %s (%s plan)\n", account.Email, account.Plan)
+	if os.Getenv(config.APIKeyEnv) != "" {
+		fmt.Fprintf(out, "Note: %s is set and takes precedence over this login\n", config.APIKeyEnv)
+	}
+	return nil
+}
+
+// deviceLogin runs the device-code flow, with instructions written to out,
+// and returns the approved API key
+func deviceLogin(ctx context.Context, client *api.Client, out io.Writer) (string, error) {
+	login, err := client.StartDeviceLogin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to start login: %w", err)
+	}
+
+	verifyURL := login.VerificationURLComplete
+	if verifyURL == "" {
+		verifyURL = login.VerificationURL
+	}
+	fmt.Fprintf(out, "Open %s and confirm the code:\n\n    %s\n\n", login.VerificationURL, login.UserCode)
+	if openBrowser(verifyURL) == nil {
+		fmt.Fprintln(out, "(Opened in your browser)")
+	}
+	fmt.Fprintln(out, "Waiting for confirmation...")
+
+	interval := time.Duration(login.Interval) * loginSecond
+	if interval <= 0 {
+		interval = 5 * loginSecond
+	}
+	deadline := time.Now().Add(time.Duration(login.ExpiresIn) * loginSecond)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("login cancelled")
+		case <-time.After(interval):
+		}
+
+		resp, err := client.PollDeviceLogin(ctx, login.DeviceCode)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", fmt.Errorf("login cancelled")
+			}
+			return "", fmt.Errorf("login failed: %w", err)
+		}
+
+		switch resp.Status {
+		case api.DeviceLoginApproved:
+			return resp.APIKey, nil
+		case api.DeviceLoginDenied:
+			return "", fmt.Errorf("login was denied in the browser")
+		case api.DeviceLoginExpired:
+			return "", fmt.Errorf("login code expired - run \"storageto login\" again")
+		}
+
+		if login.ExpiresIn > 0 && time.Now().After(deadline) {
+			return "", fmt.Errorf("login code expired - run \"storageto login\" again")
+		}
+	}
+}
+
+// openBrowser tries to open url in the default browser. It is a variable
+// so tests don't open one.
+var openBrowser = func(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+func runLogout(cmd *cobra.Command, args []string) error {
+	removed, err := config.DeleteCredentials()
+	if err != nil {
+		return fmt.Errorf("failed to remove credentials: %w", err)
+	}
+	if removed {
+		fmt.Println("Logged out")
+	} else {
+		fmt.Println("Not logged in")
+	}
+	if os.Getenv(config.APIKeyEnv) != "" {
+		fmt.Printf("Note: %s is still set and will be used\n", config.APIKeyEnv)
+	}
+	return nil
+}
+
+func runWhoami(cmd *cobra.Command, args []string) error {
+	display := messageDisplay()
+	defer display.Stop()
+
+	ctx, cancel := signalContext(display, "Cancelling...")
+	defer cancel()
+
+	client, err := newClient(display)
+	if err != nil {
+		return err
+	}
+	if client.AuthToken == "" {
+		return fmt.Errorf("not logged in - run \"storageto login\" (uploads are anonymous)")
+	}
+
+	account, err := client.GetAccount(ctx)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		output, _ := json.MarshalIndent(account, "", "  ")
+		fmt.Println(string(output))
+		return nil
+	}
+
+	fmt.Printf("Email:         %s\n", account.Email)
+	if account.Name != "" {
+		fmt.Printf("Name:          %s\n", account.Name)
+	}
+	fmt.Printf("Plan:          %s\n", account.Plan)
+	fmt.Printf("Max file size: %s\n", limitSize(account.Limits.MaxFileSize))
+	fmt.Printf("Uploads/day:   %s\n", limitCount(account.Limits.UploadsPerDay))
+	fmt.Printf("Max expiry:    %s\n", limitDays(account.Limits.MaxExpiryDays))
+	fmt.Printf("Storage:       %s\n", limitSize(account.Limits.StorageBytes))
+	return nil
+}
+
+func limitSize(n int64) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return progress.HumanSize(n)
+}
+
+func limitCount(n int) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(n)
+}
+
+func limitDays(n int) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/config"
+)
+
+func TestDeviceLogin(t *testing.T) {
+	t.Setenv(config.APIKeyEnv, "")
+	defer func(unit time.Duration) { loginSecond = unit }(loginSecond)
+	loginSecond = time.Millisecond
+	var opened []string
+	defer func(open func(string) error) { openBrowser = open }(openBrowser)
+	openBrowser = func(url string) error {
+		opened = append(opened, url)
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		statuses []string // Answers to the polls, in order
+		want     []string
+		err      string
+	}{
+		{
+			name:     "approved",
+			statuses: []string{api.DeviceLoginPending, api.DeviceLoginApproved},
+			want: []string{
+				"Open https://storage.to/device and confirm the code:",
+				"",
+				"ABCD-1234",
+				"",
+				"(Opened in your browser)",
+				"Waiting for confirmation...",
+				"Logged in as ada@example.com (pro plan)",
+			},
+		},
+		{
+			name:     "denied",
+			statuses: []string{api.DeviceLoginPending, api.DeviceLoginDenied},
+			err:      "login was denied in the browser",
+		},
+		{
+			name:     "expired",
+			statuses: []string{api.DeviceLoginExpired},
+			err:      "login code expired",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened = nil
+			var mu sync.Mutex
+			var polls int
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /api/auth/device", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(api.DeviceLogin{
+					Success: true, DeviceCode: "D1", UserCode: "ABCD-1234",
+					VerificationURL:         "https://storage.to/device",
+					VerificationURLComplete: "https://storage.to/device?code=ABCD-1234",
+					ExpiresIn:               600, Interval: 1,
+				})
+			})
+			mux.HandleFunc("POST /api/auth/device/token", func(w http.ResponseWriter, r *http.Request) {
+				var req map[string]string
+				json.NewDecoder(r.Body).Decode(&req)
+				if req["device_code"] != "D1" {
+					t.Errorf("polled with device code %q, want D1", req["device_code"])
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				resp := api.DeviceTokenResponse{Success: true, Status: tt.statuses[polls]}
+				polls++
+				if resp.Status == api.DeviceLoginApproved {
+					resp.APIKey = "key1"
+				}
+				json.NewEncoder(w).Encode(resp)
+			})
+			mux.HandleFunc("GET /api/me", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer key1" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				json.NewEncoder(w).Encode(api.MeResponse{Success: true, Account: &api.Account{Email: "ada@example.com", Plan: "pro"}})
+			})
+
+			out, err := runCommand(t, mux.ServeHTTP, "login")
+			if polls != len(tt.statuses) {
+				t.Errorf("polled %d times, want %d", polls, len(tt.statuses))
+			}
+			if len(opened) != 1 || opened[0] != "https://storage.to/device?code=ABCD-1234" {
+				t.Errorf("opened %v, want the link with the code", opened)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("login error = %v, want %q", err, tt.err)
+				}
+				if creds, _ := config.LoadCredentials(); creds != nil {
+					t.Errorf("credentials saved after a failed login: %+v", creds)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("login error = %v", err)
+			}
+			checkLines(t, out, tt.want)
+			creds, err := config.LoadCredentials()
+			if err != nil || creds == nil || creds.APIKey != "key1" || creds.Email != "ada@example.com" {
+				t.Errorf("saved credentials = %+v (%v), want key1 for ada@example.com", creds, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/crypt"
+)
+
+var (
+	decryptKey    string
+	decryptOutput string
+)
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt <file>",
+	Short: "Decrypt a file uploaded with --encrypt",
+	Long: `Decrypt a blob that was uploaded with "storageto upload --encrypt" and
+fetched some other way, e.g. with curl from the raw URL.
+
+The key can be given on its own or as the full share link.
+
+Examples:
+  storageto decrypt report.pdf.enc --key 'https://storage.to/FQxyz1234#k=...'
+  storageto decrypt blob --key <key> -o report.pdf`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDecrypt,
+}
+
+func init() {
+	rootCmd.AddCommand(decryptCmd)
+	decryptCmd.Flags().StringVarP(&decryptKey, "key", "k", "", "Decryption key or share link containing #k=")
+	decryptCmd.Flags().StringVarP(&decryptOutput, "output", "o", "", "Output file (default: input without .enc)")
+	decryptCmd.MarkFlagRequired("key")
+}
+
+func runDecrypt(cmd *cobra.Command, args []string) error {
+	key, err := parseKey(decryptKey)
+	if err != nil {
+		return err
+	}
+
+	src := args[0]
+	dst := decryptOutput
+	if dst == "" {
+		dst = crypt.DecryptedName(src)
+	}
+
+	if err := crypt.DecryptFile(key, src, dst); err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", src, err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Saved: %s\n", dst)
+	return nil
+}
+
+// parseKey accepts an encoded key or a share link with a #k= fragment
+func parseKey(s string) ([]byte, error) {
+	if strings.Contains(s, "#") {
+		ref, err := api.ParseRef(s)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Key == "" {
+			return nil, fmt.Errorf("link has no #k= key")
+		}
+		s = ref.Key
+	}
+	return crypt.DecodeKey(s)
+}
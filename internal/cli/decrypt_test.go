@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/storageto/cli/internal/crypt"
+)
+
+func TestDecrypt(t *testing.T) {
+	key, _ := crypt.GenerateKey()
+	otherKey, _ := crypt.GenerateKey()
+	encoded := crypt.EncodeKey(key)
+	er, _ := crypt.NewReader(key, strings.NewReader("secret report"))
+	sealed, _ := io.ReadAll(er)
+
+	tests := []struct {
+		name    string
+		args    []string // After the blob's path
+		output  string   // Expected file, relative to the blob's dir
+		wantErr string
+	}{
+		{"key", []string{"--key", encoded}, "report.txt", ""},
+		{"share link", []string{"--key", "https://storage.to/FQxyz1234#k=" + encoded}, "report.txt", ""},
+		{"output", []string{"--key", encoded, "-o", "OUT"}, "out.txt", ""},
+		{"wrong key", []string{"--key", crypt.EncodeKey(otherKey)}, "", "failed to decrypt"},
+		{"link without key", []string{"--key", "https://storage.to/FQxyz1234#x=1"}, "", "link has no #k= key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "report.txt"+crypt.Suffix)
+			if err := os.WriteFile(src, sealed, 0644); err != nil {
+				t.Fatal(err)
+			}
+			args := []string{"decrypt", src}
+			for _, arg := range tt.args {
+				args = append(args, strings.Replace(arg, "OUT", filepath.Join(dir, "out.txt"), 1))
+			}
+
+			out, err := runCommand(t, func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}, args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("decrypt error = %v, want %q", err, tt.wantErr)
+				}
+				if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+					t.Errorf("%d files in the output dir, want only the blob", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decrypt error = %v", err)
+			}
+
+			dst := filepath.Join(dir, tt.output)
+			if got, _ := os.ReadFile(dst); !bytes.Equal(got, []byte("secret report")) {
+				t.Errorf("%s = %q, want the plaintext", tt.output, got)
+			}
+			if out != "Saved: "+dst+"\n" {
+				t.Errorf("output = %q, want the saved path", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/config"
+	"github.com/storageto/cli/internal/download"
+	"github.com/storageto/cli/internal/progress"
+)
+
+var (
+	outputDir   string
+	downloadKey string
+	// Separate from the upload flags so each command's defaults stay its own
+	downloadPassword     bool
+	downloadPasswordFile string
+	downloadParallel     int
+)
+
+var downloadCmd = &cobra.Command{
+	Use:   "download <url-or-id> [more...]",
+	Short: "Download files or collections from storage.to",
+	Long: `Download shared files or whole collections.
+
+Accepts any storage.to link (page, raw or collection URL) or a bare ID.
+Collections are downloaded with their folder structure. Interrupted
+downloads continue where they left off when run again. Encrypted uploads
+are decrypted with the key from the link's #k= fragment or --key.
+
+Examples:
+  storageto download https://storage.to/FQxyz1234     # Single file
+  storageto download https://storage.to/c/FQabc5678  # Whole collection
+  storageto download FQxyz1234 -o ~/Downloads        # Into a directory
+  storageto download 'https://storage.to/FQxyz1234#k=...'  # Encrypted upload`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runDownload,
+}
+
+func init() {
+	rootCmd.AddCommand(downloadCmd)
+	downloadCmd.Flags().StringVarP(&outputDir, "output", "o", ".", "Directory to save files in")
+	downloadCmd.Flags().BoolVar(&downloadPassword, "password", false, "Prompt for the password of a protected link (or use $STORAGETO_PASSWORD)")
+	downloadCmd.Flags().StringVar(&downloadPasswordFile, "password-file", "", "Read the password of a protected link from this file")
+	downloadCmd.Flags().StringVar(&downloadKey, "key", "", "Decryption key for encrypted uploads (overrides the link's #k=)")
+	downloadCmd.Flags().IntVar(&downloadParallel, "parallel-files", download.DefaultConcurrentFiles, "Number of files of a collection to download at once")
+	addProgressFlags(downloadCmd)
+}
+
+func runDownload(cmd *cobra.Command, args []string) error {
+	// Resolve all arguments first so typos fail before anything is fetched
+	refs, err := parseRefs(args)
+	if err != nil {
+		return err
+	}
+
+	var key []byte
+	if downloadKey != "" {
+		if key, err = parseKey(downloadKey); err != nil {
+			return err
+		}
+	}
+
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return err
+	}
+	parallel, err := intSetting(cmd, "parallel-files", downloadParallel, "parallel_files", settings.ParallelFiles, download.MaxConcurrentFiles)
+	if err != nil {
+		return err
+	}
+
+	display, err := newDisplay()
+	if err != nil {
+		return err
+	}
+	defer display.Stop()
+
+	// Ask before setting up the signal handler so Ctrl+C at the prompt just exits
+	password, err := sharePassword(downloadPassword, downloadPasswordFile, false)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext(display, "Cancelling download...")
+	defer cancel()
+
+	client, err := newClient(display)
+	if err != nil {
+		return err
+	}
+	client.SharePassword = password
+	downloader := download.NewDownloader(client, download.Options{
+		Verbose:         verbose,
+		OutputDir:       outputDir,
+		Key:             key,
+		ConcurrentFiles: parallel,
+		Progress:        display,
+	})
+
+	for _, ref := range refs {
+		paths, err := downloader.Download(ctx, ref)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("download cancelled")
+			}
+			display.Emit(progress.Event{Type: progress.Error, Error: err.Error()})
+			return err
+		}
+		for _, p := range paths {
+			fmt.Printf("Saved: %s\n", p)
+		}
+	}
+
+	return nil
+}
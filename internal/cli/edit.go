@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/api"
+)
+
+var (
+	editExpires     string
+	editName        string
+	editDescription string
+	editCollection  string
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit <url-or-id>",
+	Short: "Change the expiry, name or description of an upload",
+	Long: `Change an existing upload without uploading it again.
+
+Works for files and collections; --name and --add-to-collection only
+apply to files. Only uploads made with this machine's identity token or
+your account can be edited.
+
+Examples:
+  storageto edit FQxyz1234 --expires 7d            # Extend a link
+  storageto edit FQxyz1234 --name report-v2.pdf    # Rename
+  storageto edit FQxyz1234 --description "Q3 numbers"
+  storageto edit FQxyz1234 --add-to-collection FQabc5678
+  storageto edit https://storage.to/c/FQabc5678 --expires 2w`,
+	Args: cobra.ExactArgs(1),
+	RunE: runEdit,
+}
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+	editCmd.Flags().StringVar(&editExpires, "expires", "", "New expiry, as a duration from now (1h, 7d, 2w) or an RFC 3339 time")
+	editCmd.Flags().StringVar(&editName, "name", "", "New filename")
+	editCmd.Flags().StringVar(&editDescription, "description", "", "Description shown on the download page (\"\" clears it)")
+	editCmd.Flags().StringVar(&editCollection, "add-to-collection", "", "Add the file to this collection (URL or ID)")
+	editCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output result as JSON")
+}
+
+func runEdit(cmd *cobra.Command, args []string) error {
+	display := messageDisplay()
+	defer display.Stop()
+
+	ctx, cancel := signalContext(display, "Cancelling...")
+	defer cancel()
+
+	if noToken {
+		return fmt.Errorf("edit needs the identity token or a login and cannot be used with --no-token")
+	}
+
+	ref, err := api.ParseRef(args[0])
+	if err != nil {
+		return err
+	}
+
+	flags := cmd.Flags()
+	if !flags.Changed("expires") && !flags.Changed("name") && !flags.Changed("description") && !flags.Changed("add-to-collection") {
+		return fmt.Errorf("nothing to change - use --expires, --name, --description or --add-to-collection")
+	}
+	if ref.Kind == api.RefCollection && (flags.Changed("name") || flags.Changed("add-to-collection")) {
+		return fmt.Errorf("--name and --add-to-collection only apply to files")
+	}
+
+	client, err := newClient(display)
+	if err != nil {
+		return err
+	}
+
+	var req api.UpdateRequest
+	if flags.Changed("expires") {
+		expiresAt, err := parseExpiry(ctx, client, editExpires)
+		if err != nil {
+			return err
+		}
+		req.ExpiresAt = &expiresAt
+	}
+	if flags.Changed("name") {
+		if editName == "" {
+			return fmt.Errorf("--name cannot be empty")
+		}
+		req.Filename = &editName
+	}
+	if flags.Changed("description") {
+		req.Description = &editDescription
+	}
+	if flags.Changed("add-to-collection") {
+		target, err := api.ParseRef(editCollection)
+		if err != nil {
+			return err
+		}
+		req.CollectionID = &target.ID
+	}
+
+	out := cmd.OutOrStdout()
+	var result interface{}
+	if ref.Kind == api.RefCollection {
+		collection, err := client.UpdateCollection(ctx, ref.ID, &req)
+		if err != nil {
+			return fmt.Errorf("failed to update collection: %w", err)
+		}
+		result = collection
+		if !jsonOutput {
+			fmt.Fprintf(out, "Collection: %s\n", collection.URL)
+			fmt.Fprintf(out, "Expires:    %s\n", collection.ExpiresAt)
+		}
+	} else {
+		file, err := client.UpdateFile(ctx, ref.ID, &req)
+		if err != nil {
+			return fmt.Errorf("failed to update file: %w", err)
+		}
+		result = file
+		if !jsonOutput {
+			fmt.Fprintf(out, "URL:     %s\n", file.URL)
+			fmt.Fprintf(out, "Name:    %s\n", file.Filename)
+			if file.Description != "" {
+				fmt.Fprintf(out, "Note:    %s\n", file.Description)
+			}
+			fmt.Fprintf(out, "Expires: %s\n", file.ExpiresAt)
+		}
+	}
+
+	if jsonOutput {
+		output, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Fprintln(out, string(output))
+	}
+	return nil
+}
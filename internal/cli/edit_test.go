@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+func TestEdit(t *testing.T) {
+	file := &api.FileInfo{ID: "FQxyz1234", Filename: "b.pdf", URL: "https://storage.to/FQxyz1234", ExpiresAt: "2026-01-02T00:00:00Z"}
+	collection := &api.CollectionInfo{ID: "FQabc5678", URL: "https://storage.to/c/FQabc5678", ExpiresAt: "2026-01-03T00:00:00Z"}
+
+	tests := []struct {
+		name    string
+		args    []string
+		request string // Expected method, path and body
+		want    []string
+		err     string
+	}{
+		{
+			name: "no changes",
+			args: []string{"FQxyz1234"},
+			err:  "nothing to change",
+		},
+		{
+			name: "rename collection",
+			args: []string{"https://storage.to/c/FQabc5678", "--name", "x"},
+			err:  "only apply to files",
+		},
+		{
+			name: "empty name",
+			args: []string{"FQxyz1234", "--name", ""},
+			err:  "--name cannot be empty",
+		},
+		{
+			name: "invalid ref",
+			args: []string{"not a link", "--name", "x"},
+			err:  "not a storage.to link or ID",
+		},
+		{
+			name: "expiry too long",
+			args: []string{"FQxyz1234", "--expires", "1000d"},
+			err:  "log in for longer expiry",
+		},
+		{
+			name:    "rename file",
+			args:    []string{"FQxyz1234", "--name", "b.pdf"},
+			request: `PATCH /api/file/FQxyz1234 {"filename":"b.pdf"}`,
+			want: []string{
+				"URL: https://storage.to/FQxyz1234",
+				"Name: b.pdf",
+				"Expires: 2026-01-02T00:00:00Z",
+			},
+		},
+		{
+			name:    "clear description and move",
+			args:    []string{"FQxyz1234", "--description", "", "--add-to-collection", "https://storage.to/c/FQabc5678"},
+			request: `PATCH /api/file/FQxyz1234 {"description":"","collection_id":"FQabc5678"}`,
+			want: []string{
+				"URL: https://storage.to/FQxyz1234",
+				"Name: b.pdf",
+				"Expires: 2026-01-02T00:00:00Z",
+			},
+		},
+		{
+			name:    "collection",
+			args:    []string{"c/FQabc5678", "--description", "Q3"},
+			request: `PATCH /api/collection/FQabc5678 {"description":"Q3"}`,
+			want: []string{
+				"Collection: https://storage.to/c/FQabc5678",
+				"Expires: 2026-01-03T00:00:00Z",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request string
+			out, err := runCommand(t, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				request = r.Method + " " + r.URL.Path + " " + string(body)
+				if strings.HasPrefix(r.URL.Path, "/api/collection/") {
+					json.NewEncoder(w).Encode(api.UpdateCollectionResponse{Success: true, Collection: collection})
+				} else {
+					json.NewEncoder(w).Encode(api.UpdateFileResponse{Success: true, File: file})
+				}
+			}, append([]string{"edit"}, tt.args...)...)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error = %v, want %q", err, tt.err)
+				}
+				if request != "" {
+					t.Errorf("sent %s, want no request", request)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if request != tt.request {
+				t.Errorf("request = %s, want %s", request, tt.request)
+			}
+			checkLines(t, out, tt.want)
+		})
+	}
+}
+
+func TestEditJSON(t *testing.T) {
+	out, err := runCommand(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(api.UpdateFileResponse{Success: true, File: &api.FileInfo{ID: "FQxyz1234", Description: "note"}})
+	}, "edit", "FQxyz1234", "--description", "note", "--json")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	var file api.FileInfo
+	if err := json.Unmarshal([]byte(out), &file); err != nil || file.ID != "FQxyz1234" || file.Description != "note" {
+		t.Errorf("output = %s, want the updated file as JSON (%v)", out, err)
+	}
+}
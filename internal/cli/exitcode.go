@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+// Exit codes, so scripts can tell "try again later" from permanent failures
+const (
+	exitError       = 1 // Anything not listed below
+	exitRateLimited = 3 // Rate limited; retry after the reset
+	exitQuota       = 4 // Plan quota exceeded
+	exitNotFound    = 5 // File or collection doesn't exist or has expired
+	exitAuth        = 6 // Not logged in, no permission or wrong password
+	exitTooLarge    = 7 // File exceeds the plan's size limit
+	exitUnavailable = 8 // Temporary server error; retry later
+)
+
+// exitCode maps an error returned by a command to the process exit code
+func exitCode(err error) int {
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) {
+		return exitError
+	}
+
+	switch apiErr.Code {
+	case api.CodeRateLimited:
+		return exitRateLimited
+	case api.CodeQuotaExceeded:
+		return exitQuota
+	case api.CodeNotFound:
+		return exitNotFound
+	case api.CodeUnauthorized, api.CodeForbidden, api.CodePasswordRequired:
+		return exitAuth
+	case api.CodeFileTooLarge:
+		return exitTooLarge
+	}
+	if apiErr.Retryable {
+		return exitUnavailable
+	}
+	return exitError
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("no files to upload"), exitError},
+		{&api.Error{StatusCode: 429, Code: api.CodeRateLimited, Retryable: true}, exitRateLimited},
+		{fmt.Errorf("failed to initialize upload: %w", &api.Error{Code: api.CodeQuotaExceeded}), exitQuota},
+		{fmt.Errorf("a: %w", fmt.Errorf("b: %w", &api.Error{Code: api.CodeNotFound})), exitNotFound},
+		{&api.Error{Code: api.CodePasswordRequired}, exitAuth},
+		{&api.Error{Code: api.CodeFileTooLarge}, exitTooLarge},
+		{&api.Error{StatusCode: 502, Code: api.CodeServerError, Retryable: true}, exitUnavailable},
+		{&api.Error{StatusCode: 400, Message: "bad filename"}, exitError},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
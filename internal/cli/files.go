@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/storageto/cli/internal/match"
+	"github.com/storageto/cli/internal/upload"
+)
+
+const ignoreFileName = ".storagetoignore"
+
+// expandOptions controls how upload arguments are turned into files
+type expandOptions struct {
+	recursive bool
+	filter    match.Filter
+	gitignore bool // Also honor .gitignore files when walking directories
+}
+
+// expandArgs expands glob patterns (including "**") into the files to upload.
+// With recursive set, directories are walked and their files are named by the
+// path relative to the directory's parent, so "storageto upload -r src/" yields
+// "src/pkg/a.go". Ignore files apply to glob matches below the pattern's base
+// directory as they do when walking it. Files named by several arguments are
+// only returned once. hasDir reports whether any argument was a directory.
+func expandArgs(args []string, opts expandOptions) (files []upload.File, hasDir bool, err error) {
+	seen := make(map[string]bool)
+	add := func(f upload.File) error {
+		abs, err := filepath.Abs(f.Path)
+		if err != nil {
+			return fmt.Errorf("cannot resolve %s: %w", f.Path, err)
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, f)
+		}
+		return nil
+	}
+
+	for _, pattern := range args {
+		matches, err := match.Glob(pattern)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			// Try as literal path
+			if _, err := os.Stat(pattern); err != nil {
+				return nil, false, fmt.Errorf("file not found: %s", pattern)
+			}
+			matches = []string{pattern}
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, false, fmt.Errorf("cannot access %s: %w", m, err)
+			}
+			if match.HasMeta(pattern) {
+				ignored, err := globIgnored(pattern, m, info.IsDir(), opts.gitignore)
+				if err != nil {
+					return nil, false, err
+				}
+				if ignored {
+					continue
+				}
+			}
+			if info.IsDir() {
+				if !opts.recursive {
+					// A "**" pattern matches directories along the way; only
+					// complain about directories the user named explicitly
+					if match.HasMeta(pattern) {
+						continue
+					}
+					return nil, false, fmt.Errorf("%s is a directory (use storageto upload -r %s)", m, m)
+				}
+				dirFiles, err := walkDir(m, opts)
+				if err != nil {
+					return nil, false, err
+				}
+				for _, f := range dirFiles {
+					if err := add(f); err != nil {
+						return nil, false, err
+					}
+				}
+				hasDir = true
+				continue
+			}
+			if !opts.filter.Allowed(filepath.ToSlash(m)) {
+				continue
+			}
+			if err := add(upload.File{Path: m, Name: filepath.Base(m)}); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	return files, hasDir, nil
+}
+
+// walkDir returns the regular files below dir that pass the filter and ignore
+// files, named relative to dir's parent
+func walkDir(dir string, opts expandOptions) ([]upload.File, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s: %w", dir, err)
+	}
+	root := filepath.Base(absDir)
+
+	var ignore match.Ignore
+	var files []upload.File
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("cannot access %s: %w", p, err)
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		name := path.Join(root, rel)
+
+		if d.IsDir() {
+			if rel != "." && (ignore.Ignored(rel, true) || opts.filter.Excluded(name)) {
+				return fs.SkipDir
+			}
+			return loadIgnoreFiles(&ignore, p, rel, opts.gitignore)
+		}
+
+		// Follow symlinks to regular files, skip everything else (sockets, devices, ...)
+		info, err := os.Stat(p)
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if ignore.Ignored(rel, false) || !opts.filter.Allowed(name) {
+			return nil
+		}
+
+		files = append(files, upload.File{Path: p, Name: name})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// globIgnored reports whether the path m matched by pattern is ignored by
+// the ignore files in the pattern's base directory or the directories
+// between it and m
+func globIgnored(pattern, m string, isDir, gitignore bool) (bool, error) {
+	base := match.GlobBase(pattern)
+	rel, err := filepath.Rel(base, m)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false, nil
+	}
+	rel = filepath.ToSlash(rel)
+
+	var ignore match.Ignore
+	if err := loadIgnoreFiles(&ignore, base, ".", gitignore); err != nil {
+		return false, err
+	}
+	elems := strings.Split(rel, "/")
+	for i := 1; i < len(elems); i++ {
+		dir := strings.Join(elems[:i], "/")
+		if ignore.Ignored(dir, true) {
+			return true, nil
+		}
+		if err := loadIgnoreFiles(&ignore, filepath.Join(base, filepath.FromSlash(dir)), dir, gitignore); err != nil {
+			return false, err
+		}
+	}
+	return ignore.Ignored(rel, isDir), nil
+}
+
+// loadIgnoreFiles adds the ignore rules found in dir
+func loadIgnoreFiles(ignore *match.Ignore, dir, rel string, gitignore bool) error {
+	base := rel
+	if base == "." {
+		base = ""
+	}
+
+	names := []string{ignoreFileName}
+	if gitignore {
+		names = append([]string{".gitignore"}, names...)
+	}
+	for _, name := range names {
+		if err := ignore.AddFile(filepath.Join(dir, name), base); err != nil {
+			return fmt.Errorf("cannot read %s: %w", filepath.Join(dir, name), err)
+		}
+	}
+	return nil
+}
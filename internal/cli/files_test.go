@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/storageto/cli/internal/match"
+)
+
+func TestExpandArgsRecursive(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "src")
+	for _, name := range []string{"a.go", "pkg/b.go", "pkg/sub/c.go"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("package x"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	if _, _, err := expandArgs([]string{root}, expandOptions{}); err == nil {
+		t.Error("expandArgs() on a directory without recursive should fail")
+	}
+
+	files, hasDir, err := expandArgs([]string{root}, expandOptions{recursive: true})
+	if err != nil {
+		t.Fatalf("expandArgs() error = %v", err)
+	}
+	if !hasDir {
+		t.Error("expandArgs() hasDir = false, want true")
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	want := []string{"src/a.go", "src/pkg/b.go", "src/pkg/sub/c.go"}
+	if len(names) != len(want) {
+		t.Fatalf("expandArgs() names = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("expandArgs() names[%d] = %q, want %q", i, names[i], want[i])
+		}
+	}
+}
+
+func TestExpandArgsIgnoreAndFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "proj")
+	for _, name := range []string{"main.go", "debug.log", "build/out.bin", "docs/a.md"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, ignoreFileName), []byte("build/\n"), 0644); err != nil {
+		t.Fatalf("failed to create ignore file: %v", err)
+	}
+
+	files, _, err := expandArgs([]string{root}, expandOptions{
+		recursive: true,
+		filter:    match.Filter{Exclude: []string{"*.log", ignoreFileName}},
+	})
+	if err != nil {
+		t.Fatalf("expandArgs() error = %v", err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	want := []string{"proj/docs/a.md", "proj/main.go"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("expandArgs() names = %v, want %v", names, want)
+	}
+}
+
+func TestExpandArgsGlobIgnore(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "proj")
+	for _, name := range []string{"main.go", "gen.go", "vendor/x/x.go", "pkg/a.go", "pkg/a_gen.go"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("package x"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	os.WriteFile(filepath.Join(root, ignoreFileName), []byte("vendor/\ngen.go\n"), 0644)
+	os.WriteFile(filepath.Join(root, "pkg", ignoreFileName), []byte("*_gen.go\n"), 0644)
+
+	files, _, err := expandArgs([]string{filepath.Join(root, "**", "*.go")}, expandOptions{})
+	if err != nil {
+		t.Fatalf("expandArgs() error = %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f.Path)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	sort.Strings(names)
+	want := []string{"main.go", "pkg/a.go"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("expandArgs() = %v, want %v", names, want)
+	}
+}
+
+func TestExpandArgsDuplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "dir")
+	for _, name := range []string{"a.txt", "sub/b.go"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{root, filepath.Join(root, "a.txt")}, 2},
+		{[]string{filepath.Join(root, "**", "*.go"), root}, 2},
+		{[]string{filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "..", "a.txt")}, 1},
+	}
+	for _, tt := range tests {
+		files, _, err := expandArgs(tt.args, expandOptions{recursive: true})
+		if err != nil {
+			t.Fatalf("expandArgs(%v) error = %v", tt.args, err)
+		}
+		if len(files) != tt.want {
+			t.Errorf("expandArgs(%v) = %v, want %d files", tt.args, files, tt.want)
+		}
+	}
+}
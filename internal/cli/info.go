@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/progress"
+)
+
+var (
+	infoPassword     bool
+	infoPasswordFile string
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info <url-or-id> [more...]",
+	Short: "Show details of a file or collection",
+	Long: `Show size, type, expiry and download count of a shared file, or the
+files of a collection.
+
+Accepts any storage.to link (page, raw or collection URL) or a bare ID.
+
+Examples:
+  storageto info https://storage.to/FQxyz1234
+  storageto info https://storage.to/c/FQabc5678
+  storageto info FQxyz1234 --json
+  storageto info FQxyz1234 --password   # A password protected link`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runInfo,
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+	infoCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output result as JSON")
+	infoCmd.Flags().BoolVar(&infoPassword, "password", false, "Prompt for the password of a protected link (or use $STORAGETO_PASSWORD)")
+	infoCmd.Flags().StringVar(&infoPasswordFile, "password-file", "", "Read the password of a protected link from this file")
+}
+
+func runInfo(cmd *cobra.Command, args []string) error {
+	display := messageDisplay()
+	defer display.Stop()
+
+	refs, err := parseRefs(args)
+	if err != nil {
+		return err
+	}
+
+	// Ask before setting up the signal handler so Ctrl+C at the prompt just exits
+	password, err := sharePassword(infoPassword, infoPasswordFile, false)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext(display, "Cancelling...")
+	defer cancel()
+
+	client, err := newClient(display)
+	if err != nil {
+		return err
+	}
+	client.SharePassword = password
+
+	out := cmd.OutOrStdout()
+	results := make([]interface{}, 0, len(refs))
+	for i, ref := range refs {
+		if ref.Kind == api.RefCollection {
+			manifest, err := client.GetCollectionManifest(ctx, ref.ID)
+			if err != nil {
+				return fmt.Errorf("failed to fetch collection %s: %w", ref.ID, err)
+			}
+			results = append(results, manifest)
+			if !jsonOutput {
+				printCollectionInfo(out, manifest)
+			}
+		} else {
+			resp, err := client.GetFile(ctx, ref.ID)
+			if err != nil {
+				return fmt.Errorf("failed to fetch file %s: %w", ref.ID, err)
+			}
+			results = append(results, resp.File)
+			if !jsonOutput {
+				printFileInfo(out, resp.File)
+			}
+		}
+		if !jsonOutput && i < len(refs)-1 {
+			fmt.Fprintln(out)
+		}
+	}
+
+	if jsonOutput {
+		var v interface{} = results
+		if len(results) == 1 {
+			v = results[0]
+		}
+		output, _ := json.MarshalIndent(v, "", "  ")
+		fmt.Fprintln(out, string(output))
+	}
+	return nil
+}
+
+func printFileInfo(w io.Writer, f *api.FileInfo) {
+	fmt.Fprintf(w, "ID:        %s\n", f.ID)
+	fmt.Fprintf(w, "Name:      %s\n", f.Filename)
+	if f.Description != "" {
+		fmt.Fprintf(w, "Note:      %s\n", f.Description)
+	}
+	fmt.Fprintf(w, "Size:      %s (%d bytes)\n", progress.HumanSize(f.Size), f.Size)
+	if f.ContentType != "" {
+		fmt.Fprintf(w, "Type:      %s\n", f.ContentType)
+	}
+	if f.MaxDownloads > 0 {
+		fmt.Fprintf(w, "Downloads: %d of %d\n", f.DownloadCount, f.MaxDownloads)
+	} else {
+		fmt.Fprintf(w, "Downloads: %d\n", f.DownloadCount)
+	}
+	if f.BurnAfterRead {
+		fmt.Fprintln(w, "Limit:     deleted after the first download")
+	}
+	if f.PasswordProtected {
+		fmt.Fprintln(w, "Access:    password protected")
+	}
+	fmt.Fprintf(w, "Expires:   %s\n", f.ExpiresAt)
+	fmt.Fprintf(w, "URL:       %s\n", f.URL)
+	fmt.Fprintf(w, "Raw:       %s\n", f.RawURL)
+}
+
+func printCollectionInfo(w io.Writer, m *api.CollectionManifest) {
+	var total int64
+	for _, f := range m.Files {
+		total += f.Size
+	}
+
+	fmt.Fprintf(w, "Collection: %s\n", m.ID)
+	fmt.Fprintf(w, "Files:      %d (%s)\n", len(m.Files), progress.HumanSize(total))
+	fmt.Fprintf(w, "Expires:    %s\n", m.ExpiresAt)
+	fmt.Fprintf(w, "URL:        %s\n", m.URL)
+	if len(m.Files) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSIZE\tTYPE\tDOWNLOADS")
+	for _, f := range m.Files {
+		contentType := f.ContentType
+		if contentType == "" {
+			contentType = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", f.ID, f.Filename, progress.HumanSize(f.Size), contentType, f.DownloadCount)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+func TestInfo(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/file/F1":
+			json.NewEncoder(w).Encode(api.GetFileResponse{Success: true, File: &api.FileInfo{
+				ID: "F1", Filename: "a.pdf", Size: 2048, ContentType: "application/pdf", DownloadCount: 3,
+				ExpiresAt: "2026-01-02", URL: "https://storage.to/F1", RawURL: "https://storage.to/r/F1",
+			}})
+		case "/api/file/F2":
+			json.NewEncoder(w).Encode(api.GetFileResponse{Success: true, File: &api.FileInfo{
+				ID: "F2", Filename: "b.txt", Description: "notes", Size: 5, MaxDownloads: 1, BurnAfterRead: true,
+				PasswordProtected: true, ExpiresAt: "2026-01-03", URL: "https://storage.to/F2", RawURL: "https://storage.to/r/F2",
+			}})
+		case "/api/file/F3":
+			json.NewEncoder(w).Encode(api.GetFileResponse{Success: true})
+		case "/c/C1.json":
+			json.NewEncoder(w).Encode(api.CollectionManifest{ID: "C1", ExpiresAt: "2026-01-04", URL: "https://storage.to/c/C1", Files: []api.FileInfo{
+				{ID: "F1", Filename: "a.pdf", Size: 2048, ContentType: "application/pdf", DownloadCount: 3},
+				{ID: "F4", Filename: "c.bin", Size: 1024},
+			}})
+		case "/c/C2.json":
+			json.NewEncoder(w).Encode(api.CollectionManifest{ID: "C2", ExpiresAt: "2026-01-05", URL: "https://storage.to/c/C2"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		err  string
+	}{
+		{
+			name: "file",
+			args: []string{"https://storage.to/F1"},
+			want: []string{
+				"ID: F1",
+				"Name: a.pdf",
+				"Size: 2.0 KB (2048 bytes)",
+				"Type: application/pdf",
+				"Downloads: 3",
+				"Expires: 2026-01-02",
+				"URL: https://storage.to/F1",
+				"Raw: https://storage.to/r/F1",
+			},
+		},
+		{
+			name: "restricted file",
+			args: []string{"r/F2"},
+			want: []string{
+				"ID: F2",
+				"Name: b.txt",
+				"Note: notes",
+				"Size: 5 B (5 bytes)",
+				"Downloads: 0 of 1",
+				"Limit: deleted after the first download",
+				"Access: password protected",
+				"Expires: 2026-01-03",
+				"URL: https://storage.to/F2",
+				"Raw: https://storage.to/r/F2",
+			},
+		},
+		{
+			name: "collection",
+			args: []string{"https://storage.to/c/C1"},
+			want: []string{
+				"Collection: C1",
+				"Files: 2 (3.0 KB)",
+				"Expires: 2026-01-04",
+				"URL: https://storage.to/c/C1",
+				"",
+				"ID NAME SIZE TYPE DOWNLOADS",
+				"F1 a.pdf 2.0 KB application/pdf 3",
+				"F4 c.bin 1.0 KB - 0",
+			},
+		},
+		{
+			name: "empty collection and file",
+			args: []string{"c/C2", "F1"},
+			want: []string{
+				"Collection: C2",
+				"Files: 0 (0 B)",
+				"Expires: 2026-01-05",
+				"URL: https://storage.to/c/C2",
+				"",
+				"ID: F1",
+				"Name: a.pdf",
+				"Size: 2.0 KB (2048 bytes)",
+				"Type: application/pdf",
+				"Downloads: 3",
+				"Expires: 2026-01-02",
+				"URL: https://storage.to/F1",
+				"Raw: https://storage.to/r/F1",
+			},
+		},
+		{
+			name: "invalid ref",
+			args: []string{"F1", "https://storage.to/"},
+			err:  "not a storage.to link or ID",
+		},
+		{
+			name: "not found",
+			args: []string{"F9"},
+			err:  "failed to fetch file F9",
+		},
+		{
+			name: "no file in response",
+			args: []string{"F3"},
+			err:  "no file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runCommand(t, handler, append([]string{"info"}, tt.args...)...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			checkLines(t, out, tt.want)
+		})
+	}
+
+	// JSON is an object for one argument and an array for several
+	out, err := runCommand(t, handler, "info", "F1", "--json")
+	var file api.FileInfo
+	if err != nil || json.Unmarshal([]byte(out), &file) != nil || file.ID != "F1" {
+		t.Errorf("info --json = %s (%v), want the file", out, err)
+	}
+	out, err = runCommand(t, handler, "info", "F1", "c/C1", "--json")
+	var results []json.RawMessage
+	if err != nil || json.Unmarshal([]byte(out), &results) != nil || len(results) != 2 {
+		t.Errorf("info --json with two refs = %s (%v), want an array of two", out, err)
+	}
+}
+
+func TestInfoPassword(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(api.SharePasswordHeader) != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Password required"})
+			return
+		}
+		json.NewEncoder(w).Encode(api.GetFileResponse{Success: true, File: &api.FileInfo{ID: "F5", Filename: "secret.txt", PasswordProtected: true}})
+	}
+	passwordFile := writeFiles(t, map[string]string{"password": "hunter2\n"})["password"]
+
+	tests := []struct {
+		name string
+		args []string
+		env  string
+		err  string
+	}{
+		{"no password", nil, "", "Password required"},
+		{"password file", []string{"--password-file", passwordFile}, "", ""},
+		{"password from env", []string{"--password"}, "hunter2", ""},
+		{"wrong password", []string{"--password"}, "letmein", "Password required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(passwordEnv, tt.env)
+			out, err := runCommand(t, handler, append([]string{"info", "F5"}, tt.args...)...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !strings.Contains(out, "secret.txt") {
+				t.Errorf("output = %q, want the file's details", out)
+			}
+		})
+	}
+}
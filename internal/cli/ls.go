@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/api"
+)
+
+var (
+	lsCollections bool
+	lsExpired     bool
+	lsLimit       int
+)
+
+var lsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List your recent uploads",
+	Long: `List files (or collections) uploaded from this machine, or from your
+account when logged in. Newest first.
+
+Examples:
+  storageto ls                 # Active files
+  storageto ls --collections   # Active collections
+  storageto ls --expired       # Include expired uploads
+  storageto ls --json          # For scripting`,
+	Args: cobra.NoArgs,
+	RunE: runLs,
+}
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+	lsCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output result as JSON")
+	lsCmd.Flags().BoolVar(&lsCollections, "collections", false, "List collections instead of files")
+	lsCmd.Flags().BoolVar(&lsExpired, "expired", false, "Include expired uploads")
+	lsCmd.Flags().IntVarP(&lsLimit, "limit", "n", 50, "Maximum number of entries")
+}
+
+func runLs(cmd *cobra.Command, args []string) error {
+	display := messageDisplay()
+	defer display.Stop()
+
+	ctx, cancel := signalContext(display, "Cancelling...")
+	defer cancel()
+
+	if noToken {
+		return fmt.Errorf("ls needs the identity token or a login and cannot be used with --no-token")
+	}
+	client, err := newClient(display)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListUploads(ctx, api.ListUploadsOptions{
+		Collections: lsCollections,
+		Expired:     lsExpired,
+		Limit:       lsLimit,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list uploads: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if jsonOutput {
+		// Print [] rather than null when there is nothing
+		var v interface{} = append([]api.UploadEntry{}, resp.Files...)
+		if lsCollections {
+			v = append([]api.CollectionEntry{}, resp.Collections...)
+		}
+		output, _ := json.MarshalIndent(v, "", "  ")
+		fmt.Fprintln(out, string(output))
+		return nil
+	}
+
+	if len(resp.Files) == 0 && len(resp.Collections) == 0 {
+		fmt.Fprintln(out, "No uploads")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if lsCollections {
+		fmt.Fprintln(w, "ID\tFILES\tSIZE\tEXPIRES\tURL")
+		for _, c := range resp.Collections {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", c.ID, c.FileCount, c.HumanSize, expiresColumn(c.ExpiresAt, c.Expired), c.URL)
+		}
+	} else {
+		fmt.Fprintln(w, "ID\tFILENAME\tSIZE\tEXPIRES\tURL")
+		for _, f := range resp.Files {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.ID, f.Filename, f.HumanSize, expiresColumn(f.ExpiresAt, f.Expired), f.URL)
+		}
+	}
+	return w.Flush()
+}
+
+func expiresColumn(expiresAt string, expired bool) string {
+	if expired {
+		return "expired"
+	}
+	return expiresAt
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+func TestLs(t *testing.T) {
+	files := []api.UploadEntry{
+		{FileInfo: api.FileInfo{ID: "F1", Filename: "a.txt", HumanSize: "1 KB", ExpiresAt: "2026-01-02", URL: "https://storage.to/F1"}},
+		{FileInfo: api.FileInfo{ID: "F2", Filename: "b.txt", HumanSize: "2 KB", URL: "https://storage.to/F2"}, Expired: true},
+	}
+	collections := []api.CollectionEntry{
+		{CollectionInfo: api.CollectionInfo{ID: "C1", ExpiresAt: "2026-01-03", URL: "https://storage.to/c/C1"}, FileCount: 3, HumanSize: "5 KB"},
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		query string // Expected query string
+		resp  api.ListUploadsResponse
+		want  []string // Lines of output, compared without spacing
+		err   string
+	}{
+		{
+			name:  "empty",
+			query: "limit=50&type=files",
+			resp:  api.ListUploadsResponse{Success: true},
+			want:  []string{"No uploads"},
+		},
+		{
+			name:  "empty json",
+			args:  []string{"--json"},
+			query: "limit=50&type=files",
+			resp:  api.ListUploadsResponse{Success: true},
+			want:  []string{"[]"},
+		},
+		{
+			name:  "files",
+			query: "limit=50&type=files",
+			resp:  api.ListUploadsResponse{Success: true, Files: files},
+			want: []string{
+				"ID FILENAME SIZE EXPIRES URL",
+				"F1 a.txt 1 KB 2026-01-02 https://storage.to/F1",
+				"F2 b.txt 2 KB expired https://storage.to/F2",
+			},
+		},
+		{
+			name:  "page of collections",
+			args:  []string{"--collections", "--expired", "-n", "1"},
+			query: "expired=1&limit=1&type=collections",
+			resp:  api.ListUploadsResponse{Success: true, Collections: collections},
+			want: []string{
+				"ID FILES SIZE EXPIRES URL",
+				"C1 3 5 KB 2026-01-03 https://storage.to/c/C1",
+			},
+		},
+		{
+			name: "no token",
+			args: []string{"--no-token"},
+			err:  "cannot be used with --no-token",
+		},
+		{
+			name: "server error",
+			resp: api.ListUploadsResponse{Error: "not allowed"},
+			err:  "failed to list uploads: not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runCommand(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.query != "" && r.URL.RawQuery != tt.query {
+					t.Errorf("query = %q, want %q", r.URL.RawQuery, tt.query)
+				}
+				json.NewEncoder(w).Encode(tt.resp)
+			}, append([]string{"ls"}, tt.args...)...)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			checkLines(t, out, tt.want)
+		})
+	}
+}
+
+// checkLines compares output with the wanted lines, ignoring how columns
+// are padded
+func checkLines(t *testing.T, out string, want []string) {
+	t.Helper()
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("output has %d lines, want %d:\n%s", len(lines), len(want), out)
+	}
+	for i, line := range lines {
+		if got := strings.Join(strings.Fields(line), " "); got != want[i] {
+			t.Errorf("line %d = %q, want %q", i+1, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// passwordEnv supplies share passwords without a prompt, e.g. in scripts
+const passwordEnv = "STORAGETO_PASSWORD"
+
+// sharePassword returns the share password selected by the --password and
+// --password-file flags: read from the file, else from $STORAGETO_PASSWORD,
+// else prompted for on the terminal. It returns "" if neither flag is set.
+// confirm asks twice when prompting, for setting a new password.
+func sharePassword(ask bool, file string, confirm bool) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		// Only the first line counts, so files written by echo work
+		password := strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r")
+		if password == "" {
+			return "", fmt.Errorf("password file %s is empty", file)
+		}
+		return password, nil
+	}
+	if !ask {
+		return "", nil
+	}
+	if password := os.Getenv(passwordEnv); password != "" {
+		return password, nil
+	}
+
+	password, err := promptPassword("Password: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+	if confirm {
+		again, err := promptPassword("Repeat password: ")
+		if err != nil {
+			return "", err
+		}
+		if again != password {
+			return "", fmt.Errorf("passwords do not match")
+		}
+	}
+	return password, nil
+}
+
+// promptPassword reads a line from the terminal without echoing it. The
+// terminal is used even when stdin is redirected, so "upload -" can prompt.
+func promptPassword(prompt string) (string, error) {
+	tty, err := openTTY()
+	if err != nil {
+		return "", fmt.Errorf("no terminal to ask for a password - use --password-file or %s", passwordEnv)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, prompt)
+	restore, err := disableEcho(tty)
+	if err != nil {
+		return "", fmt.Errorf("cannot hide password input: %w", err)
+	}
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	restore()
+	fmt.Fprintln(os.Stderr)
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+func openTTY() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+// disableEcho turns off terminal echo and returns a func restoring it.
+// Echo is also restored if the user presses Ctrl+C at the prompt.
+func disableEcho(tty *os.File) (func(), error) {
+	if err := stty(tty, "-echo"); err != nil {
+		return nil, err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigChan:
+			stty(tty, "echo")
+			os.Stderr.WriteString("\n")
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+		stty(tty, "echo")
+	}, nil
+}
+
+func stty(tty *os.File, arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = tty
+	return cmd.Run()
+}
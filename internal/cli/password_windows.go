@@ -0,0 +1,35 @@
+//go:build windows
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const enableEchoInput = 0x0004
+
+var (
+	kernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleMode = kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode = kernel32.NewProc("SetConsoleMode")
+)
+
+func openTTY() (*os.File, error) {
+	return os.OpenFile("CONIN$", os.O_RDWR, 0)
+}
+
+// disableEcho turns off console echo and returns a func restoring it
+func disableEcho(tty *os.File) (func(), error) {
+	var mode uint32
+	if r, _, err := procGetConsoleMode.Call(tty.Fd(), uintptr(unsafe.Pointer(&mode))); r == 0 {
+		return nil, err
+	}
+	if r, _, err := procSetConsoleMode.Call(tty.Fd(), uintptr(mode&^enableEchoInput)); r == 0 {
+		return nil, err
+	}
+	return func() {
+		procSetConsoleMode.Call(tty.Fd(), uintptr(mode))
+	}, nil
+}
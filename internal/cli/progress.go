@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/progress"
+)
+
+var (
+	quiet        bool
+	progressMode string
+)
+
+// addProgressFlags adds --quiet and --progress to a command that transfers
+// files
+func addProgressFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Print only the result, warnings and errors")
+	cmd.Flags().StringVar(&progressMode, "progress", "", "Show progress as bar, plain (periodic lines), none or json (events); default bar on a terminal, plain otherwise")
+}
+
+// newDisplay starts the progress display on stderr selected by --quiet and
+// --progress. Stop it before printing results.
+func newDisplay() (*progress.Display, error) {
+	mode := progress.Auto
+	if progressMode != "" {
+		var err error
+		if mode, err = progress.ParseMode(progressMode); err != nil {
+			return nil, err
+		}
+	}
+	if quiet {
+		if verbose {
+			return nil, fmt.Errorf("--quiet cannot be used with --verbose")
+		}
+		if progressMode != "" {
+			return nil, fmt.Errorf("--quiet cannot be used with --progress")
+		}
+		mode = progress.Quiet
+	}
+	return progress.New(os.Stderr, mode), nil
+}
+
+// messageDisplay starts a Display on stderr for commands that show no
+// progress, so they can still count down a rate limit wait or say they are
+// cancelled. Stop it when done.
+func messageDisplay() *progress.Display {
+	return progress.New(os.Stderr, progress.Auto)
+}
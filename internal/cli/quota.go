@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/progress"
+)
+
+var quotaCmd = &cobra.Command{
+	Use:   "quota",
+	Short: "Show today's uploads used and remaining",
+	Args:  cobra.NoArgs,
+	RunE:  runQuota,
+}
+
+func init() {
+	rootCmd.AddCommand(quotaCmd)
+	quotaCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output result as JSON")
+}
+
+func runQuota(cmd *cobra.Command, args []string) error {
+	display := messageDisplay()
+	defer display.Stop()
+
+	ctx, cancel := signalContext(display, "Cancelling...")
+	defer cancel()
+
+	client, err := newClient(display)
+	if err != nil {
+		return err
+	}
+	quota, err := client.GetQuota(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch quota: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if jsonOutput {
+		output, _ := json.MarshalIndent(quota, "", "  ")
+		fmt.Fprintln(out, string(output))
+		return nil
+	}
+
+	fmt.Fprintf(out, "Plan:          %s\n", quota.Plan)
+	if quota.UploadsPerDay > 0 {
+		remaining := quota.UploadsPerDay - quota.UploadsUsed
+		if remaining < 0 {
+			remaining = 0
+		}
+		fmt.Fprintf(out, "Uploads today: %d of %d (%d remaining)\n", quota.UploadsUsed, quota.UploadsPerDay, remaining)
+		if quota.ResetsInSeconds > 0 {
+			fmt.Fprintf(out, "Resets in:     %s\n", progress.FormatDuration(time.Duration(quota.ResetsInSeconds)*time.Second))
+		}
+	} else {
+		fmt.Fprintf(out, "Uploads today: %d (no daily limit)\n", quota.UploadsUsed)
+	}
+	fmt.Fprintf(out, "Max file size: %s\n", limitSize(quota.MaxFileSize))
+	if quota.StorageLimit > 0 {
+		fmt.Fprintf(out, "Storage:       %s of %s\n", progress.HumanSize(quota.StorageUsed), progress.HumanSize(quota.StorageLimit))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+func TestQuota(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		resp api.QuotaResponse
+		want []string
+		err  string
+	}{
+		{
+			name: "anonymous",
+			resp: api.QuotaResponse{Success: true, Quota: &api.Quota{
+				Plan: "anonymous", UploadsPerDay: 20, UploadsUsed: 22, ResetsInSeconds: 3600, MaxFileSize: 5 << 30,
+			}},
+			want: []string{
+				"Plan: anonymous",
+				"Uploads today: 22 of 20 (0 remaining)",
+				"Resets in: 1h00m",
+				"Max file size: 5.0 GB",
+			},
+		},
+		{
+			name: "account",
+			resp: api.QuotaResponse{Success: true, Quota: &api.Quota{
+				Plan: "pro", UploadsUsed: 3, StorageUsed: 1 << 30, StorageLimit: 100 << 30,
+			}},
+			want: []string{
+				"Plan: pro",
+				"Uploads today: 3 (no daily limit)",
+				"Max file size: unlimited",
+				"Storage: 1.0 GB of 100.0 GB",
+			},
+		},
+		{
+			name: "json",
+			args: []string{"--json"},
+			resp: api.QuotaResponse{Success: true, Quota: &api.Quota{Plan: "anonymous", UploadsPerDay: 20}},
+			want: []string{
+				"{",
+				`"plan": "anonymous",`,
+				`"uploads_per_day": 20,`,
+				`"uploads_used": 0,`,
+				`"resets_in_seconds": 0,`,
+				`"max_file_size": 0`,
+				"}",
+			},
+		},
+		{
+			name: "no quota",
+			resp: api.QuotaResponse{Success: true},
+			err:  "failed to fetch quota: server response has no quota",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runCommand(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/quota" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				json.NewEncoder(w).Encode(tt.resp)
+			}, append([]string{"quota"}, tt.args...)...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			checkLines(t, out, tt.want)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/progress"
+)
+
+// defaultRateLimitWait is used when the server doesn't say when a rate
+// limit resets
+const defaultRateLimitWait = time.Minute
+
+// rateLimitWaiter sleeps until a rate limit resets, counting down in the
+// status line of display. Concurrent requests that hit the limit share one
+// countdown.
+type rateLimitWaiter struct {
+	mu      sync.Mutex
+	display *progress.Display
+}
+
+func (w *rateLimitWaiter) wait(ctx context.Context, apiErr *api.Error) error {
+	wait := apiErr.ResetsIn
+	if wait <= 0 {
+		wait = defaultRateLimitWait
+	}
+	deadline := time.Now().Add(wait)
+
+	// Whoever waited before us has already sat out this reset
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	defer w.display.SetStatus("")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		remaining := time.Until(deadline).Round(time.Second)
+		switch {
+		case remaining <= 0:
+			return nil
+		case apiErr.Limit > 0:
+			w.display.SetStatus(fmt.Sprintf("Rate limited (%d/%d used), retrying in %s", apiErr.Used, apiErr.Limit, progress.FormatDuration(remaining)))
+		default:
+			w.display.SetStatus("Rate limited, retrying in " + progress.FormatDuration(remaining))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/progress"
+)
+
+func TestRateLimitWaiter(t *testing.T) {
+	var buf bytes.Buffer
+	display := progress.New(&buf, progress.JSON)
+	w := &rateLimitWaiter{display: display}
+
+	start := time.Now()
+	if err := w.wait(context.Background(), &api.Error{Limit: 10, Used: 10, ResetsIn: 600 * time.Millisecond}); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("wait() returned after %s, before the limit reset", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.wait(ctx, &api.Error{ResetsIn: time.Hour}); err != context.Canceled {
+		t.Errorf("wait() after cancel = %v, want context.Canceled", err)
+	}
+	display.Stop()
+
+	// Both waits are announced as events, nothing else is written
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		`"message":"Rate limited (10/10 used), retrying in 1s"`,
+		`"message":"Rate limited, retrying in 1h00m"`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("output = %q, want %d events", buf.String(), len(want))
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, `{"type":"message"`) || !strings.Contains(line, want[i]) {
+			t.Errorf("line %d = %s, want a message event with %s", i, line, want[i])
+		}
+	}
+}
+
+func TestRateLimitWaiterNoDisplay(t *testing.T) {
+	w := &rateLimitWaiter{}
+	if err := w.wait(context.Background(), &api.Error{ResetsIn: 10 * time.Millisecond}); err != nil {
+		t.Errorf("wait() error = %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/api"
+)
+
+var (
+	rmYes        bool
+	rmCollection bool
+)
+
+var rmCmd = &cobra.Command{
+	Use:   "rm <url-or-id> [more...]",
+	Short: "Delete uploaded files or collections",
+	Long: `Delete uploads so their links stop working immediately.
+
+Only uploads made with this machine's identity token or your account can
+be deleted. Deleting a collection deletes all of its files.
+
+Examples:
+  storageto rm https://storage.to/FQxyz1234      # A file
+  storageto rm https://storage.to/c/FQabc5678   # A collection
+  storageto rm --collection FQabc5678           # Collection by bare ID
+  storageto rm FQxyz1234 FQxyz5678 --yes        # No confirmation prompt`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runRm,
+}
+
+func init() {
+	rootCmd.AddCommand(rmCmd)
+	rmCmd.Flags().BoolVarP(&rmYes, "yes", "y", false, "Delete without asking for confirmation")
+	rmCmd.Flags().BoolVarP(&rmCollection, "collection", "c", false, "Treat bare IDs as collection IDs")
+}
+
+func runRm(cmd *cobra.Command, args []string) error {
+	if noToken {
+		return fmt.Errorf("rm needs the identity token or a login and cannot be used with --no-token")
+	}
+
+	refs, err := rmRefs(args, rmCollection)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if !rmYes {
+		ok, err := confirmDelete(cmd.InOrStdin(), out, refs)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(out, "Nothing deleted")
+			return nil
+		}
+	}
+
+	// Only after the prompt, so Ctrl+C there exits right away
+	display := messageDisplay()
+	defer display.Stop()
+
+	ctx, cancel := signalContext(display, "Cancelling...")
+	defer cancel()
+
+	client, err := newClient(display)
+	if err != nil {
+		return err
+	}
+
+	// Keep going on failure so one bad ID doesn't leave the rest online
+	var failed int
+	for _, ref := range refs {
+		if ctx.Err() != nil {
+			return fmt.Errorf("cancelled")
+		}
+		if ref.Kind == api.RefCollection {
+			err = client.DeleteCollection(ctx, ref.ID)
+		} else {
+			err = client.DeleteFile(ctx, ref.ID)
+		}
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Failed to delete %s: %v\n", describeRef(ref), err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "Deleted %s\n", describeRef(ref))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deletions failed", failed, len(refs))
+	}
+	return nil
+}
+
+// rmRefs resolves the arguments of rm. With collection set, bare IDs are
+// collection IDs; links and c/ or r/ paths say themselves what they are.
+func rmRefs(args []string, collection bool) ([]api.Ref, error) {
+	refs, err := parseRefs(args)
+	if err != nil {
+		return nil, err
+	}
+	if collection {
+		for i, arg := range args {
+			if !strings.Contains(arg, "/") {
+				refs[i].Kind = api.RefCollection
+			}
+		}
+	}
+	return refs, nil
+}
+
+// confirmDelete asks before deleting refs, reading the answer from in. If
+// in is a file, it must be a terminal.
+func confirmDelete(in io.Reader, out io.Writer, refs []api.Ref) (bool, error) {
+	if file, ok := in.(*os.File); ok {
+		if stat, err := file.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+			return false, fmt.Errorf("not running in a terminal - use --yes to delete without confirmation")
+		}
+	}
+
+	fmt.Fprintln(out, "This will permanently delete:")
+	for _, ref := range refs {
+		fmt.Fprintf(out, "  %s\n", describeRef(ref))
+	}
+	fmt.Fprint(out, "Continue? [y/N] ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil {
+		return false, nil
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func describeRef(ref api.Ref) string {
+	if ref.Kind == api.RefCollection {
+		return "collection " + ref.ID
+	}
+	return "file " + ref.ID
+}
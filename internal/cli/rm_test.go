@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+func TestRmRefs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		collection bool
+		want       []string
+	}{
+		{[]string{"F1", "https://storage.to/c/C1"}, false, []string{"file F1", "collection C1"}},
+		{[]string{"C1", "C2"}, true, []string{"collection C1", "collection C2"}},
+		{[]string{"C1", "https://storage.to/F1", "r/F2", "c/C2"}, true, []string{"collection C1", "file F1", "file F2", "collection C2"}},
+	}
+	for _, tt := range tests {
+		refs, err := rmRefs(tt.args, tt.collection)
+		if err != nil {
+			t.Fatalf("rmRefs(%v) error = %v", tt.args, err)
+		}
+		var got []string
+		for _, ref := range refs {
+			got = append(got, describeRef(ref))
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("rmRefs(%v, %v) = %v, want %v", tt.args, tt.collection, got, tt.want)
+		}
+	}
+
+	if _, err := rmRefs([]string{"F1", "https://example.com/"}, false); err == nil {
+		t.Error("rmRefs() with an invalid link should fail")
+	}
+}
+
+func TestRm(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		input   string
+		deleted []string // Requests the server got
+		want    string   // Expected in the output
+		err     string
+	}{
+		{
+			name:    "yes",
+			args:    []string{"F1", "c/C1", "--yes"},
+			deleted: []string{"/api/file/F1", "/api/collection/C1"},
+			want:    "Deleted file F1\nDeleted collection C1\n",
+		},
+		{
+			name:    "confirmed",
+			args:    []string{"F1"},
+			input:   "y\n",
+			deleted: []string{"/api/file/F1"},
+			want:    "This will permanently delete:\n  file F1\nContinue? [y/N] Deleted file F1\n",
+		},
+		{
+			name:  "declined",
+			args:  []string{"F1"},
+			input: "\n",
+			want:  "This will permanently delete:\n  file F1\nContinue? [y/N] Nothing deleted\n",
+		},
+		{
+			name: "no answer",
+			args: []string{"F1"},
+			want: "This will permanently delete:\n  file F1\nContinue? [y/N] Nothing deleted\n",
+		},
+		{
+			name:    "bare collection IDs",
+			args:    []string{"-c", "C1", "https://storage.to/F1", "-y"},
+			deleted: []string{"/api/collection/C1", "/api/file/F1"},
+			want:    "Deleted collection C1\nDeleted file F1\n",
+		},
+		{
+			name:    "partial failure",
+			args:    []string{"missing", "F1", "-y"},
+			deleted: []string{"/api/file/missing", "/api/file/F1"},
+			want:    "Deleted file F1\n",
+			err:     "1 of 2 deletions failed",
+		},
+		{
+			name: "no token",
+			args: []string{"F1", "-y", "--no-token"},
+			err:  "cannot be used with --no-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
+			out, err := runCommandInput(t, tt.input, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete {
+					t.Errorf("got %s %s, want DELETE", r.Method, r.URL.Path)
+				}
+				deleted = append(deleted, r.URL.Path)
+				if strings.HasSuffix(r.URL.Path, "/missing") {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write([]byte(`{"success":true}`))
+			}, append([]string{"rm"}, tt.args...)...)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error = %v, want %q", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if strings.Join(deleted, " ") != strings.Join(tt.deleted, " ") {
+				t.Errorf("requests = %v, want %v", deleted, tt.deleted)
+			}
+			if out != tt.want {
+				t.Errorf("output = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmDeleteNeedsTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	w.Write([]byte("y\n"))
+
+	_, err = confirmDelete(r, io.Discard, []api.Ref{{ID: "F1"}})
+	if err == nil || !strings.Contains(err.Error(), "use --yes") {
+		t.Errorf("error = %v, want a hint to use --yes", err)
+	}
+}
@@ -1,16 +1,28 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/config"
+	"github.com/storageto/cli/internal/progress"
+	"github.com/storageto/cli/internal/retry"
 )
 
 var (
 	apiURL  string
 	verbose bool
 	noToken bool
+
+	waitOnRateLimit bool
+	retries         int
+	retryMaxWait    time.Duration
 )
 
 var rootCmd = &cobra.Command{
@@ -21,18 +33,100 @@ var rootCmd = &cobra.Command{
 Examples:
   storageto upload photo.jpg              Upload a single file
   storageto upload *.log --collection     Upload multiple files as a collection
-  storageto upload backup.tar.gz          Large files are automatically chunked`,
+  storageto upload backup.tar.gz          Large files are automatically chunked
+  storageto download <url>                Download a shared file or collection
+  storageto login                         Log in for your account's limits`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Without a wait, retries would hammer the server in a busy loop
+		if retryMaxWait <= 0 {
+			return fmt.Errorf("--retry-max-wait must be greater than 0 (use --retries 0 to turn retries off)")
+		}
+		return nil
+	},
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&apiURL, "api", "https://storage.to", "API base URL")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
-	rootCmd.PersistentFlags().BoolVar(&noToken, "no-token", false, "Run without persistent identity token (fully anonymous)")
+	rootCmd.PersistentFlags().BoolVar(&noToken, "no-token", false, "Run without persistent identity token or login (fully anonymous)")
+	rootCmd.PersistentFlags().BoolVar(&waitOnRateLimit, "wait-on-rate-limit", false, "Wait for the rate limit to reset instead of failing")
+	rootCmd.PersistentFlags().IntVar(&retries, "retries", retry.DefaultRetries, "Retry failed requests and uploads up to N times")
+	rootCmd.PersistentFlags().DurationVar(&retryMaxWait, "retry-max-wait", retry.DefaultMaxWait, "Longest wait between retries")
+}
+
+// newClient creates an API client with the visitor token and account
+// credentials (unless --no-token is set) that honors --wait-on-rate-limit
+// and the retry flags. Rate limit waits are shown on display.
+func newClient(display *progress.Display) (*api.Client, error) {
+	var client *api.Client
+	if noToken {
+		client = api.NewClient(apiURL, "")
+	} else {
+		visitorToken, err := config.GetVisitorToken()
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize: %w", err)
+		}
+		client = api.NewClient(apiURL, visitorToken)
+
+		client.AuthToken, err = config.GetAPIKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if waitOnRateLimit {
+		client.RateLimitWait = (&rateLimitWaiter{display: display}).wait
+	}
+	client.Retry = retryPolicy()
+	return client, nil
+}
+
+// retryPolicy returns the retry policy set by --retries and --retry-max-wait
+func retryPolicy() retry.Policy {
+	return retry.Policy{
+		Attempts:  max(retries, 0) + 1,
+		BaseDelay: min(retry.DefaultBaseDelay, retryMaxWait),
+		MaxWait:   retryMaxWait,
+	}
+}
+
+// parseRefs resolves every argument to a file or collection, failing on the
+// first that isn't a storage.to link or ID
+func parseRefs(args []string) ([]api.Ref, error) {
+	refs := make([]api.Ref, len(args))
+	for i, arg := range args {
+		ref, err := api.ParseRef(arg)
+		if err != nil {
+			return nil, err
+		}
+		refs[i] = ref
+	}
+	return refs, nil
+}
+
+// signalContext returns a context that is cancelled on Ctrl+C or SIGTERM,
+// printing msg on display when that happens
+func signalContext(display *progress.Display, msg string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigChan:
+			display.Printf("\n%s\n", msg)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigChan)
+	}()
+
+	return ctx, cancel
 }
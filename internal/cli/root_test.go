@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/storageto/cli/internal/config"
+)
+
+// runCommand runs the CLI with args against the API served by handler and
+// returns what it printed to stdout. Config files go to a temp dir.
+func runCommand(t *testing.T, handler http.HandlerFunc, args ...string) (string, error) {
+	t.Helper()
+	return runCommandInput(t, "", handler, args...)
+}
+
+// runCommandInput is runCommand with stdin reading input
+func runCommandInput(t *testing.T, input string, handler http.HandlerFunc, args ...string) (string, error) {
+	t.Helper()
+	return runCommandSettings(t, input, "", handler, args...)
+}
+
+// runCommandSettings is runCommandInput with settings, if not empty,
+// written to config.json first
+func runCommandSettings(t *testing.T, input, settings string, handler http.HandlerFunc, args ...string) (string, error) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	if settings != "" {
+		path, err := config.SettingsPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, []byte(settings), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resetFlags(rootCmd)
+	rootCmd.SilenceUsage = true
+	defer func() { rootCmd.SilenceUsage = false }()
+	var out bytes.Buffer
+	rootCmd.SetIn(strings.NewReader(input))
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(io.Discard)
+	rootCmd.SetArgs(append(args, "--api", srv.URL))
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+// resetFlags restores the defaults of cmd's flags and those of its
+// subcommands, which keep their values between runs
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if v, ok := f.Value.(pflag.SliceValue); ok {
+			v.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+func TestRetryMaxWait(t *testing.T) {
+	for _, wait := range []string{"0", "-1s"} {
+		_, err := runCommand(t, nil, "ls", "--retry-max-wait", wait)
+		if err == nil || !strings.Contains(err.Error(), "--retry-max-wait") {
+			t.Errorf("--retry-max-wait %s: error = %v, want it rejected", wait, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/progress"
+	"github.com/storageto/cli/internal/throttle"
+)
+
+// intSetting resolves an int option that can be set by flag or by key in
+// the config file. The flag wins when given; either way the value must be
+// between 1 and max. It returns 0, meaning the built-in default, when
+// neither is set. Settings without a flag pass flag "".
+func intSetting(cmd *cobra.Command, flag string, value int, key string, setting, max int) (int, error) {
+	name := "--" + flag
+	if !cmd.Flags().Changed(flag) {
+		if setting == 0 {
+			return 0, nil
+		}
+		value = setting
+		name = key + " in the config file"
+	}
+	if value < 1 || value > max {
+		return 0, fmt.Errorf("%s must be between 1 and %d", name, max)
+	}
+	return value, nil
+}
+
+// sizeSetting resolves a size such as "64MB" like intSetting. The size must
+// be between min and max bytes.
+func sizeSetting(cmd *cobra.Command, flag, value, key, setting string, min, max int64) (int64, error) {
+	name := "--" + flag
+	if !cmd.Flags().Changed(flag) {
+		if setting == "" {
+			return 0, nil
+		}
+		value = setting
+		name = key + " in the config file"
+	}
+	size, err := throttle.ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if size < min || size > max {
+		return 0, fmt.Errorf("%s must be between %s and %s", name, progress.HumanSize(min), progress.HumanSize(max))
+	}
+	return size, nil
+}
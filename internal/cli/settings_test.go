@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/storageto/cli/internal/upload"
+)
+
+func TestSizeSetting(t *testing.T) {
+	tests := []struct {
+		flag    string // Set with --part-size if not empty
+		setting string
+		want    int64
+		wantErr string
+	}{
+		{"", "", 0, ""},
+		{"", "16MB", 16 << 20, ""},
+		{"64M", "16MB", 64 << 20, ""},
+		{"5G", "", 5 << 30, ""},
+		{"4MB", "", 0, "--part-size must be between 5.0 MB and 5.0 GB"},
+		{"", "6GB", 0, "part_size in the config file must be between 5.0 MB and 5.0 GB"},
+		{"", "large", 0, `part_size in the config file: invalid size "large" - use e.g. 16MB or 1GB`},
+	}
+	for _, tt := range tests {
+		var value string
+		cmd := &cobra.Command{}
+		cmd.Flags().StringVar(&value, "part-size", "", "")
+		if tt.flag != "" {
+			cmd.Flags().Set("part-size", tt.flag)
+		}
+
+		got, err := sizeSetting(cmd, "part-size", value, "part_size", tt.setting, upload.MinPartSize, upload.MaxPartSize)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("flag %q, setting %q: error = %v, want %q", tt.flag, tt.setting, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("flag %q, setting %q = %d, %v, want %d", tt.flag, tt.setting, got, err, tt.want)
+		}
+	}
+}
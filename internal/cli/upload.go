@@ -5,19 +5,43 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"syscall"
+	"sort"
+	"time"
 
+	"github.com/spf13/cobra"
 	"github.com/storageto/cli/internal/api"
 	"github.com/storageto/cli/internal/config"
+	"github.com/storageto/cli/internal/crypt"
+	"github.com/storageto/cli/internal/match"
+	"github.com/storageto/cli/internal/progress"
+	"github.com/storageto/cli/internal/throttle"
 	"github.com/storageto/cli/internal/upload"
-	"github.com/spf13/cobra"
 )
 
 var (
-	collection bool
-	jsonOutput bool
+	collection    bool
+	jsonOutput    bool
+	resume        bool
+	recursive     bool
+	includes      []string
+	excludes      []string
+	gitignore     bool
+	uploadName    string
+	archiveFormat string
+	encrypt       bool
+	expires       string
+	maxDownloads  int
+	burnAfterRead bool
+	usePassword   bool
+	passwordFile  string
+	toCollection  string
+	parallelFiles int
+	parallelParts int
+	partSize      string
+	limitRate     string
+	checksum      string
+	dedup         bool
 )
 
 var uploadCmd = &cobra.Command{
@@ -29,7 +53,18 @@ Examples:
   storageto upload photo.jpg                    # Single file
   storageto upload doc.pdf image.png            # Multiple files (auto-collection)
   storageto upload *.log --collection           # Explicit collection
-  storageto upload backup.tar.gz                # Large files auto-chunk`,
+  storageto upload -r build/                    # Directory, keeps relative paths
+  storageto upload 'src/**/*.go'                # Recursive glob
+  storageto upload -r . --exclude '*.log'       # Skip matching files
+  storageto upload backup.tar.gz                # Large files auto-chunk
+  storageto upload backup.tar.gz --resume       # Continue an interrupted upload
+  pg_dump mydb | storageto upload - --name dump.sql  # Upload from stdin
+  storageto upload --archive tar.gz dir1 file2  # One archive instead of a collection
+  storageto upload --encrypt secrets.tar        # Encrypt locally, key stays in the link
+  storageto upload report.pdf --expires 1h      # Custom expiry (m, h, d, w or RFC 3339)
+  storageto upload key.pem --burn-after-read    # Deleted after the first download
+  storageto upload contract.pdf --password      # Prompts for an access password
+  storageto upload more.log --to-collection FQabc5678  # Add to an existing collection`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: runUpload,
 }
@@ -38,94 +73,370 @@ func init() {
 	rootCmd.AddCommand(uploadCmd)
 	uploadCmd.Flags().BoolVarP(&collection, "collection", "c", false, "Create a collection for multiple files")
 	uploadCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output result as JSON")
+	uploadCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Upload directories recursively as a collection")
+	uploadCmd.Flags().StringArrayVar(&includes, "include", nil, "Only upload files matching this glob (repeatable, supports **)")
+	uploadCmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Skip files matching this glob (repeatable, supports **)")
+	uploadCmd.Flags().BoolVar(&gitignore, "gitignore", false, "Honor .gitignore files in addition to .storagetoignore")
+	uploadCmd.Flags().StringVar(&uploadName, "name", "", "Filename for stdin (-) or --archive uploads")
+	uploadCmd.Flags().StringVar(&archiveFormat, "archive", "", "Upload all inputs as one archive (tar.gz or zip)")
+	uploadCmd.Flags().BoolVar(&resume, "resume", false, "Resume an interrupted large upload and keep it resumable if cancelled")
+	uploadCmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt files before upload; the key is added to the link's #fragment")
+	uploadCmd.Flags().StringVar(&expires, "expires", "", "Expire after a duration (1h, 7d, 2w) or at an RFC 3339 time")
+	uploadCmd.Flags().IntVar(&maxDownloads, "max-downloads", 0, "Expire after this many downloads")
+	uploadCmd.Flags().BoolVar(&burnAfterRead, "burn-after-read", false, "Delete after the first download")
+	uploadCmd.Flags().BoolVar(&usePassword, "password", false, "Protect the link with a password (prompted, or from $STORAGETO_PASSWORD)")
+	uploadCmd.Flags().StringVar(&passwordFile, "password-file", "", "Protect the link with the password in this file")
+	uploadCmd.Flags().StringVar(&toCollection, "to-collection", "", "Add the files to an existing collection (URL or ID)")
+	uploadCmd.Flags().IntVar(&parallelFiles, "parallel-files", upload.DefaultConcurrentFiles, "Number of files to upload at once")
+	uploadCmd.Flags().IntVar(&parallelParts, "parallel-parts", upload.DefaultConcurrentParts, "Number of parts of a large file to upload at once")
+	uploadCmd.Flags().StringVar(&partSize, "part-size", "", "Size of the parts of a large file, e.g. 64MB (5MB to 5GB; default chosen by the server)")
+	uploadCmd.Flags().StringVar(&limitRate, "limit-rate", "", "Limit upload bandwidth, e.g. 500KB/s or 5MB/s")
+	uploadCmd.Flags().StringVar(&checksum, "checksum", "", "Verify uploads with a checksum (sha256 or crc32c) and print the digest")
+	uploadCmd.Flags().BoolVar(&dedup, "dedup", false, "Skip sending files whose content was uploaded before or repeats in this upload")
+	addProgressFlags(uploadCmd)
 }
 
 func runUpload(cmd *cobra.Command, args []string) error {
-	// Set up context with cancellation for Ctrl+C
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// "-" uploads stdin instead of files
+	fromStdin := len(args) == 1 && args[0] == "-"
+	var files []upload.File
+	var asCollection bool
+	if fromStdin {
+		if collection || recursive || archiveFormat != "" {
+			return fmt.Errorf("--collection, --recursive and --archive cannot be used when uploading stdin")
+		}
+		if dedup {
+			return fmt.Errorf("--dedup cannot be used when uploading stdin")
+		}
+		if resume {
+			return fmt.Errorf("--resume cannot be used when uploading stdin")
+		}
+	} else {
+		for _, arg := range args {
+			if arg == "-" {
+				return fmt.Errorf("- (stdin) must be the only argument")
+			}
+		}
 
-	// Handle interrupt signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sigChan
-		fmt.Println("\nCancelling upload...")
-		cancel()
-	}()
-
-	// Expand globs and validate files
-	var files []string
-	for _, pattern := range args {
-		matches, err := filepath.Glob(pattern)
+		// Expand globs and directories
+		filter := match.Filter{Include: includes, Exclude: excludes}
+		if err := filter.Validate(); err != nil {
+			return err
+		}
+		var hasDir bool
+		var err error
+		files, hasDir, err = expandArgs(args, expandOptions{
+			recursive: recursive || archiveFormat != "",
+			filter:    filter,
+			gitignore: gitignore,
+		})
 		if err != nil {
-			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			return err
 		}
-		if len(matches) == 0 {
-			// Try as literal path
-			if _, err := os.Stat(pattern); err != nil {
-				return fmt.Errorf("file not found: %s", pattern)
-			}
-			matches = []string{pattern}
+
+		if len(files) == 0 {
+			return fmt.Errorf("no files to upload")
 		}
-		for _, match := range matches {
-			info, err := os.Stat(match)
-			if err != nil {
-				return fmt.Errorf("cannot access %s: %w", match, err)
-			}
-			if info.IsDir() {
-				return fmt.Errorf("%s is a directory (use storageto upload %s/* for contents)", match, match)
-			}
-			files = append(files, match)
+
+		// Auto-collection for multiple files
+		asCollection = collection || len(files) > 1 || hasDir
+		if archiveFormat != "" && collection {
+			return fmt.Errorf("--archive uploads a single file and cannot be used with --collection")
+		}
+		if archiveFormat != "" && dedup {
+			return fmt.Errorf("--dedup cannot be used with --archive")
+		}
+		if resume && (asCollection || archiveFormat != "") {
+			return fmt.Errorf("--resume only works when uploading a single file")
 		}
 	}
 
-	if len(files) == 0 {
-		return fmt.Errorf("no files to upload")
+	var collectionID string
+	if toCollection != "" {
+		ref, err := api.ParseRef(toCollection)
+		if err != nil {
+			return err
+		}
+		if usePassword || passwordFile != "" {
+			return fmt.Errorf("--password cannot be used with --to-collection; the collection keeps its own password")
+		}
+		if encrypt {
+			// The collection's existing files use a different key
+			return fmt.Errorf("--encrypt cannot be used with --to-collection")
+		}
+		if resume {
+			return fmt.Errorf("--resume only works when uploading a single file")
+		}
+		if collection {
+			return fmt.Errorf("--collection creates a new collection and cannot be used with --to-collection")
+		}
+		collectionID = ref.ID
 	}
 
-	// Auto-collection for multiple files
-	asCollection := collection || len(files) > 1
-
-	// Get visitor token (unless --no-token is set)
-	var visitorToken string
-	if !noToken {
+	// The key never leaves this machine except in the printed links
+	var key []byte
+	if encrypt {
+		if resume {
+			return fmt.Errorf("--resume cannot be used with --encrypt")
+		}
+		if dedup {
+			// Every upload is encrypted differently, so nothing would match
+			return fmt.Errorf("--dedup cannot be used with --encrypt")
+		}
 		var err error
-		visitorToken, err = config.GetVisitorToken()
+		key, err = crypt.GenerateKey()
 		if err != nil {
-			return fmt.Errorf("failed to initialize: %w", err)
+			return fmt.Errorf("failed to generate encryption key: %w", err)
 		}
 	}
 
+	limits, err := uploadConcurrency(cmd)
+	if err != nil {
+		return err
+	}
+	if err := upload.CheckChecksum(checksum); err != nil {
+		return err
+	}
+	display, err := newDisplay()
+	if err != nil {
+		return err
+	}
+	defer display.Stop()
+
+	// Ask before setting up the signal handler so Ctrl+C at the prompt just exits
+	password, err := sharePassword(usePassword, passwordFile, true)
+	if err != nil {
+		return err
+	}
+
+	// Set up context with cancellation for Ctrl+C
+	ctx, cancel := signalContext(display, "Cancelling upload...")
+	defer cancel()
+
 	// Create client and uploader
-	client := api.NewClient(apiURL, visitorToken)
-	uploader := upload.NewUploader(client, verbose)
+	client, err := newClient(display)
+	if err != nil {
+		return err
+	}
+	share, err := shareOptions(ctx, client)
+	if err != nil {
+		return err
+	}
+	uploader := upload.NewUploader(client, upload.Options{
+		Verbose:          verbose,
+		Resume:           resume,
+		EncryptKey:       key,
+		Share:            share,
+		Password:         password,
+		Collection:       collectionID,
+		Retry:            client.Retry,
+		ConcurrentFiles:  limits.ConcurrentFiles,
+		ConcurrentParts:  limits.ConcurrentParts,
+		BatchSize:        limits.BatchSize,
+		PartURLBatchSize: limits.PartURLBatchSize,
+		PartSize:         limits.PartSize,
+		LimitRate:        limits.LimitRate,
+		Checksum:         checksum,
+		Dedup:            dedup,
+		Progress:         display,
+	})
 
 	// Do the upload
-	result, err := uploader.UploadFiles(ctx, files, asCollection)
+	var result *upload.Result
+	if fromStdin {
+		name := uploadName
+		if name == "" {
+			name = "stdin"
+		}
+		var fileInfo *api.FileInfo
+		fileInfo, err = uploader.UploadStream(ctx, os.Stdin, name, collectionID)
+		result = &upload.Result{FileInfo: fileInfo}
+	} else if archiveFormat != "" {
+		var fileInfo *api.FileInfo
+		fileInfo, err = uploader.UploadArchive(ctx, files, archiveFormat, archiveName(args, archiveFormat), collectionID)
+		result = &upload.Result{FileInfo: fileInfo}
+	} else {
+		result, err = uploader.UploadFiles(ctx, files, asCollection)
+	}
+	if err == nil && collectionID != "" && !result.IsCollection {
+		file := result.FileInfo
+		result, err = uploader.FinishCollection(ctx, collectionID)
+		if err == nil && file.Checksum != "" {
+			result.ChecksumAlgorithm = file.ChecksumAlgorithm
+			result.Checksums = map[string]string{file.Filename: file.Checksum}
+		}
+	}
 	if err != nil {
 		if ctx.Err() != nil {
-			return fmt.Errorf("upload cancelled")
+			err = fmt.Errorf("upload cancelled")
 		}
+		display.Emit(progress.Event{Type: progress.Error, Error: err.Error()})
 		return err
 	}
+	display.Stop()
+
+	if key != nil {
+		result.EncryptionKey = crypt.EncodeKey(key)
+		fragment := "#k=" + result.EncryptionKey
+		if result.IsCollection {
+			result.Collection.URL += fragment
+		} else {
+			result.FileInfo.URL += fragment
+		}
+	}
 
 	// Print result
+	out := cmd.OutOrStdout()
 	if jsonOutput {
 		output, _ := json.MarshalIndent(result, "", "  ")
-		fmt.Println(string(output))
+		fmt.Fprintln(out, string(output))
 	} else {
-		fmt.Println()
+		fmt.Fprintln(out)
 		if result.IsCollection {
-			fmt.Printf("Collection: %s\n", result.Collection.URL)
-			fmt.Printf("Expires:    %s\n", result.Collection.ExpiresAt)
+			fmt.Fprintf(out, "Collection: %s\n", result.Collection.URL)
+			fmt.Fprintf(out, "Expires:    %s\n", result.Collection.ExpiresAt)
+			if result.EncryptionKey != "" {
+				fmt.Fprintf(out, "Key:        %s\n", result.EncryptionKey)
+			}
+			if result.Collection.PasswordProtected {
+				fmt.Fprintln(out, "Access:     password protected")
+			}
+			if len(result.Checksums) > 0 {
+				// Same format as sha256sum, so the list can be checked with -c
+				fmt.Fprintf(out, "\n%s checksums:\n", upload.ChecksumName(result.ChecksumAlgorithm))
+				names := make([]string, 0, len(result.Checksums))
+				for name := range result.Checksums {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Fprintf(out, "%s  %s\n", result.Checksums[name], name)
+				}
+			}
 		} else {
-			fmt.Printf("URL:     %s\n", result.FileInfo.URL)
-			fmt.Printf("Raw:     %s\n", result.FileInfo.RawURL)
-			fmt.Printf("Size:    %s\n", result.FileInfo.HumanSize)
-			fmt.Printf("Expires: %s\n", result.FileInfo.ExpiresAt)
+			fmt.Fprintf(out, "URL:     %s\n", result.FileInfo.URL)
+			fmt.Fprintf(out, "Raw:     %s\n", result.FileInfo.RawURL)
+			fmt.Fprintf(out, "Size:    %s\n", result.FileInfo.HumanSize)
+			fmt.Fprintf(out, "Expires: %s\n", result.FileInfo.ExpiresAt)
+			if result.FileInfo.PasswordProtected {
+				fmt.Fprintln(out, "Access:  password protected")
+			}
+			if result.FileInfo.BurnAfterRead {
+				fmt.Fprintln(out, "Limit:   deleted after the first download")
+			} else if result.FileInfo.MaxDownloads > 0 {
+				fmt.Fprintf(out, "Limit:   %d downloads\n", result.FileInfo.MaxDownloads)
+			}
+			if result.EncryptionKey != "" {
+				fmt.Fprintf(out, "Key:     %s\n", result.EncryptionKey)
+			}
+			if result.FileInfo.Checksum != "" {
+				fmt.Fprintf(out, "%-8s %s\n", upload.ChecksumName(result.FileInfo.ChecksumAlgorithm)+":", result.FileInfo.Checksum)
+			}
+		}
+		if result.EncryptionKey != "" {
+			fmt.Fprintln(out, "\nAnyone with the full link can decrypt. The key is not sent to storage.to.")
 		}
 	}
 
 	return nil
 }
+
+// archiveName returns the filename for an --archive upload: --name if given,
+// otherwise the name of the single input or "archive"
+func archiveName(args []string, format string) string {
+	if uploadName != "" {
+		return uploadName
+	}
+	base := "archive"
+	if len(args) == 1 && !match.HasMeta(args[0]) {
+		if abs, err := filepath.Abs(args[0]); err == nil {
+			base = filepath.Base(abs)
+		}
+	}
+	return base + "." + format
+}
+
+// shareOptions builds the share options from the flags
+func shareOptions(ctx context.Context, client *api.Client) (api.ShareOptions, error) {
+	var share api.ShareOptions
+	if maxDownloads < 0 {
+		return share, fmt.Errorf("--max-downloads must be positive")
+	}
+	if burnAfterRead && maxDownloads > 1 {
+		return share, fmt.Errorf("--burn-after-read allows one download and cannot be used with --max-downloads %d", maxDownloads)
+	}
+	share.MaxDownloads = maxDownloads
+	share.BurnAfterRead = burnAfterRead
+
+	if expires != "" {
+		var err error
+		if share.ExpiresAt, err = parseExpiry(ctx, client, expires); err != nil {
+			return share, err
+		}
+	}
+	return share, nil
+}
+
+// parseExpiry parses an --expires value into an RFC 3339 timestamp, checking
+// it against the plan limit so the server doesn't refuse only after an upload
+func parseExpiry(ctx context.Context, client *api.Client, value string) (string, error) {
+	now := time.Now()
+	expiresAt, err := upload.ParseExpiry(value, now)
+	if err != nil {
+		return "", err
+	}
+
+	limit := upload.AnonymousMaxExpiry
+	if client.AuthToken != "" {
+		// Leave the check to the server if the account can't be fetched
+		limit = 0
+		if account, err := client.GetAccount(ctx); err == nil {
+			limit = time.Duration(account.Limits.MaxExpiryDays) * 24 * time.Hour
+		}
+	}
+	if err := upload.CheckExpiry(expiresAt, now, limit); err != nil {
+		if client.AuthToken == "" {
+			return "", fmt.Errorf("%w for anonymous uploads - log in for longer expiry", err)
+		}
+		return "", fmt.Errorf("%w on your plan", err)
+	}
+
+	return expiresAt.UTC().Format(time.RFC3339), nil
+}
+
+// uploadConcurrency returns Options with the concurrency, batch sizes, part
+// size and bandwidth limit set by flags or the config file
+func uploadConcurrency(cmd *cobra.Command) (upload.Options, error) {
+	var opts upload.Options
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return opts, err
+	}
+
+	if opts.ConcurrentFiles, err = intSetting(cmd, "parallel-files", parallelFiles, "parallel_files", settings.ParallelFiles, upload.MaxConcurrentFiles); err != nil {
+		return opts, err
+	}
+	if opts.ConcurrentParts, err = intSetting(cmd, "parallel-parts", parallelParts, "parallel_parts", settings.ParallelParts, upload.MaxConcurrentParts); err != nil {
+		return opts, err
+	}
+	if opts.BatchSize, err = intSetting(cmd, "", 0, "batch_size", settings.BatchSize, upload.MaxBatchSize); err != nil {
+		return opts, err
+	}
+	if opts.PartURLBatchSize, err = intSetting(cmd, "", 0, "part_url_batch_size", settings.PartURLBatchSize, upload.MaxPartURLBatchSize); err != nil {
+		return opts, err
+	}
+	if opts.PartSize, err = sizeSetting(cmd, "part-size", partSize, "part_size", settings.PartSize, upload.MinPartSize, upload.MaxPartSize); err != nil {
+		return opts, err
+	}
+
+	rate := settings.LimitRate
+	if cmd.Flags().Changed("limit-rate") {
+		rate = limitRate
+	}
+	if rate != "" {
+		if opts.LimitRate, err = throttle.ParseRate(rate); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+// fakeUploadAPI is the upload API for CLI tests. Every file goes up in a
+// single PUT and the requests it received are recorded.
+type fakeUploadAPI struct {
+	// collections are the IDs --to-collection may use; others are not found
+	collections map[string]bool
+
+	mu            sync.Mutex
+	inits         []api.InitUploadRequest
+	batchInits    []api.InitBatchRequest
+	confirms      []api.ConfirmUploadRequest
+	batchConfirms []api.ConfirmBatchRequest
+	created       int      // Collections created
+	ready         []string // Collection IDs marked ready
+}
+
+func (f *fakeUploadAPI) handler(t *testing.T) http.HandlerFunc {
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, v interface{}) {
+		json.NewEncoder(w).Encode(v)
+	}
+	decode := func(r *http.Request, v interface{}) {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			t.Errorf("%s: cannot decode request: %v", r.URL.Path, err)
+		}
+	}
+	notFound := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+		reply(w, map[string]interface{}{"success": false, "error": "Collection not found"})
+	}
+	putURL := func(r *http.Request, name string) string {
+		return "http://" + r.Host + "/put/" + name
+	}
+	file := func(r *http.Request, name string) *api.FileInfo {
+		return &api.FileInfo{ID: name, Filename: name, URL: "http://" + r.Host + "/" + name}
+	}
+
+	mux.HandleFunc("POST /api/upload/init", func(w http.ResponseWriter, r *http.Request) {
+		var req api.InitUploadRequest
+		decode(r, &req)
+		f.mu.Lock()
+		f.inits = append(f.inits, req)
+		f.mu.Unlock()
+		reply(w, api.InitUploadResponse{Success: true, Type: "single", UploadURL: putURL(r, req.Filename), R2Key: req.Filename})
+	})
+	mux.HandleFunc("POST /api/upload/init-batch", func(w http.ResponseWriter, r *http.Request) {
+		var req api.InitBatchRequest
+		decode(r, &req)
+		f.mu.Lock()
+		f.batchInits = append(f.batchInits, req)
+		f.mu.Unlock()
+		resp := api.InitBatchResponse{Success: true, Results: make(map[string]api.InitBatchResult)}
+		for i, file := range req.Files {
+			resp.Results[strconv.Itoa(i)] = api.InitBatchResult{Success: true, Type: "single", UploadURL: putURL(r, file.Filename), R2Key: file.Filename}
+		}
+		reply(w, resp)
+	})
+	mux.HandleFunc("PUT /put/{name}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /api/upload/confirm", func(w http.ResponseWriter, r *http.Request) {
+		var req api.ConfirmUploadRequest
+		decode(r, &req)
+		f.mu.Lock()
+		f.confirms = append(f.confirms, req)
+		f.mu.Unlock()
+		if req.CollectionID != "" && !f.collections[req.CollectionID] {
+			notFound(w)
+			return
+		}
+		reply(w, api.ConfirmUploadResponse{Success: true, File: file(r, req.Filename)})
+	})
+	mux.HandleFunc("POST /api/upload/confirm-batch", func(w http.ResponseWriter, r *http.Request) {
+		var req api.ConfirmBatchRequest
+		decode(r, &req)
+		f.mu.Lock()
+		f.batchConfirms = append(f.batchConfirms, req)
+		f.mu.Unlock()
+		if !f.collections[req.CollectionID] {
+			notFound(w)
+			return
+		}
+		resp := api.ConfirmBatchResponse{Success: true, Results: make(map[string]api.ConfirmBatchResult)}
+		for i, c := range req.Files {
+			resp.Results[strconv.Itoa(i)] = api.ConfirmBatchResult{Success: true, File: file(r, c.Filename)}
+		}
+		reply(w, resp)
+	})
+	mux.HandleFunc("POST /api/collection", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.created++
+		id := "N" + strconv.Itoa(f.created)
+		if f.collections == nil {
+			f.collections = make(map[string]bool)
+		}
+		f.collections[id] = true
+		f.mu.Unlock()
+		reply(w, api.CreateCollectionResponse{Success: true, Collection: &api.CollectionInfo{ID: id}})
+	})
+	mux.HandleFunc("POST /api/collection/{id}/ready", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		f.mu.Lock()
+		f.ready = append(f.ready, id)
+		f.mu.Unlock()
+		if !f.collections[id] {
+			notFound(w)
+			return
+		}
+		reply(w, api.MarkCollectionReadyResponse{Success: true, Collection: &api.CollectionInfo{ID: id, URL: "http://" + r.Host + "/c/" + id}})
+	})
+	return mux.ServeHTTP
+}
+
+// writeFiles creates files with the given names and contents in a temp dir
+// and returns their paths
+func writeFiles(t *testing.T, files map[string]string) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make(map[string]string, len(files))
+	for name, content := range files {
+		paths[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[name], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestUploadPartSize(t *testing.T) {
+	paths := writeFiles(t, map[string]string{"a.txt": "a"})
+
+	tests := []struct {
+		name   string
+		args   []string
+		config string
+		want   int64
+	}{
+		{"default", nil, "", 0},
+		{"flag", []string{"--part-size", "64MB"}, "", 64 << 20},
+		{"config", nil, `{"part_size": "16MB"}`, 16 << 20},
+		{"flag over config", []string{"--part-size", "8M"}, `{"part_size": "16MB"}`, 8 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeUploadAPI{}
+			args := append([]string{"upload", "-q", paths["a.txt"]}, tt.args...)
+			_, err := runCommandSettings(t, "", tt.config, fake.handler(t), args...)
+			if err != nil {
+				t.Fatalf("upload error = %v", err)
+			}
+			if len(fake.inits) != 1 || fake.inits[0].PartSize != tt.want {
+				t.Errorf("init requests = %+v, want part size %d", fake.inits, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadToCollection(t *testing.T) {
+	paths := writeFiles(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	tests := []struct {
+		name  string
+		files []string
+		to    string
+	}{
+		{"one file by ID", []string{paths["a.txt"]}, "FQabc5678"},
+		{"several files by URL", []string{paths["a.txt"], paths["b.txt"]}, "https://storage.to/c/FQabc5678"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeUploadAPI{collections: map[string]bool{"FQabc5678": true}}
+			args := append([]string{"upload", "-q", "--to-collection", tt.to}, tt.files...)
+			out, err := runCommand(t, fake.handler(t), args...)
+			if err != nil {
+				t.Fatalf("upload error = %v", err)
+			}
+
+			if fake.created != 0 {
+				t.Errorf("%d collections created, want the files added to FQabc5678", fake.created)
+			}
+			if len(fake.batchConfirms) != 1 || fake.batchConfirms[0].CollectionID != "FQabc5678" || len(fake.batchConfirms[0].Files) != len(tt.files) {
+				t.Errorf("confirmed %+v, want %d files in FQabc5678", fake.batchConfirms, len(tt.files))
+			}
+			if fmt.Sprint(fake.ready) != "[FQabc5678]" {
+				t.Errorf("collections marked ready = %v, want [FQabc5678]", fake.ready)
+			}
+			if !strings.Contains(out, "Collection: http://") || !strings.Contains(out, "/c/FQabc5678\n") {
+				t.Errorf("output = %q, want the collection's link", out)
+			}
+		})
+	}
+}
+
+func TestUploadToUnknownCollection(t *testing.T) {
+	paths := writeFiles(t, map[string]string{"a.txt": "a"})
+
+	// Someone else's collection looks the same as one that doesn't exist
+	fake := &fakeUploadAPI{collections: map[string]bool{"FQabc5678": true}}
+	_, err := runCommand(t, fake.handler(t), "upload", "-q", "--to-collection", "FQother99", paths["a.txt"])
+	if err == nil || !strings.Contains(err.Error(), "Collection not found") {
+		t.Fatalf("upload error = %v, want collection not found", err)
+	}
+	if got := exitCode(err); got != exitNotFound {
+		t.Errorf("exit code = %d, want %d", got, exitNotFound)
+	}
+	if fake.created != 0 || len(fake.ready) != 0 {
+		t.Errorf("created %d collections and marked %v ready, want neither", fake.created, fake.ready)
+	}
+}
+
+func TestUploadFlagConflicts(t *testing.T) {
+	paths := writeFiles(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"resume with several files", []string{paths["a.txt"], paths["b.txt"], "--resume"}, "--resume only works when uploading a single file"},
+		{"resume with collection", []string{paths["a.txt"], "--collection", "--resume"}, "--resume only works when uploading a single file"},
+		{"resume with archive", []string{paths["a.txt"], "--archive", "zip", "--resume"}, "--resume only works when uploading a single file"},
+		{"resume with to-collection", []string{paths["a.txt"], "--to-collection", "C1", "--resume"}, "--resume only works when uploading a single file"},
+		{"collection with to-collection", []string{paths["a.txt"], "--collection", "--to-collection", "C1"}, "cannot be used with --to-collection"},
+		{"password with to-collection", []string{paths["a.txt"], "--password-file", paths["b.txt"], "--to-collection", "C1"}, "cannot be used with --to-collection"},
+		{"encrypt with to-collection", []string{paths["a.txt"], "--encrypt", "--to-collection", "C1"}, "cannot be used with --to-collection"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeUploadAPI{}
+			_, err := runCommand(t, fake.handler(t), append([]string{"upload", "-q"}, tt.args...)...)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("upload error = %v, want %q", err, tt.err)
+			}
+			if len(fake.inits)+len(fake.batchInits) != 0 {
+				t.Errorf("uploads started: %+v %+v", fake.inits, fake.batchInits)
+			}
+		})
+	}
+}
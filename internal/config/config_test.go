@@ -83,3 +83,89 @@ func TestGetConfigDir(t *testing.T) {
 		}
 	}
 }
+
+func TestCredentials(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalHome := os.Getenv("HOME")
+	originalXDG := os.Getenv("XDG_CONFIG_HOME")
+	originalKey := os.Getenv(APIKeyEnv)
+	os.Setenv("HOME", tmpDir)
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, ".config"))
+	os.Unsetenv(APIKeyEnv)
+	defer func() {
+		os.Setenv("HOME", originalHome)
+		os.Setenv("XDG_CONFIG_HOME", originalXDG)
+		os.Setenv(APIKeyEnv, originalKey)
+	}()
+
+	// Not logged in
+	key, err := GetAPIKey()
+	if err != nil || key != "" {
+		t.Fatalf("GetAPIKey() = %q, %v before login, want empty", key, err)
+	}
+
+	if err := SaveCredentials(&Credentials{APIKey: "sk_test", Email: "a@example.com"}); err != nil {
+		t.Fatalf("SaveCredentials() error = %v", err)
+	}
+	key, err = GetAPIKey()
+	if err != nil || key != "sk_test" {
+		t.Errorf("GetAPIKey() = %q, %v, want sk_test", key, err)
+	}
+
+	// File must not be readable by others
+	path, _ := credentialsPath()
+	if stat, err := os.Stat(path); err != nil {
+		t.Fatalf("credentials file not created: %v", err)
+	} else if runtime.GOOS != "windows" && stat.Mode().Perm() != 0600 {
+		t.Errorf("credentials file mode = %v, want 0600", stat.Mode().Perm())
+	}
+
+	// Environment wins over the stored key
+	os.Setenv(APIKeyEnv, "sk_env")
+	if key, _ := GetAPIKey(); key != "sk_env" {
+		t.Errorf("GetAPIKey() = %q, want sk_env from environment", key)
+	}
+	os.Unsetenv(APIKeyEnv)
+
+	removed, err := DeleteCredentials()
+	if err != nil || !removed {
+		t.Errorf("DeleteCredentials() = %v, %v, want true", removed, err)
+	}
+	if creds, _ := LoadCredentials(); creds != nil {
+		t.Errorf("LoadCredentials() after delete = %+v, want nil", creds)
+	}
+	if removed, _ := DeleteCredentials(); removed {
+		t.Error("DeleteCredentials() twice should report nothing removed")
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalHome := os.Getenv("HOME")
+	originalXDG := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("HOME", tmpDir)
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, ".config"))
+	defer func() {
+		os.Setenv("HOME", originalHome)
+		os.Setenv("XDG_CONFIG_HOME", originalXDG)
+	}()
+
+	// No config file
+	settings, err := LoadSettings()
+	if err != nil || *settings != (Settings{}) {
+		t.Fatalf("LoadSettings() = %+v, %v without a file, want zero settings", settings, err)
+	}
+
+	path, _ := SettingsPath()
+	os.MkdirAll(filepath.Dir(path), 0700)
+	os.WriteFile(path, []byte(`{"parallel_files": 2, "parallel_parts": 16}`), 0600)
+	settings, err = LoadSettings()
+	if err != nil || settings.ParallelFiles != 2 || settings.ParallelParts != 16 {
+		t.Errorf("LoadSettings() = %+v, %v, want 2 files and 16 parts", settings, err)
+	}
+
+	os.WriteFile(path, []byte(`{"parallel_files": "many"}`), 0600)
+	if _, err := LoadSettings(); err == nil {
+		t.Error("LoadSettings() should fail for an invalid file")
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	credentialsFile = "credentials.json"
+
+	// APIKeyEnv overrides stored credentials, e.g. in CI
+	APIKeyEnv = "STORAGETO_API_KEY"
+)
+
+// Credentials identify a storage.to account
+type Credentials struct {
+	APIKey    string    `json:"api_key"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func credentialsPath() (string, error) {
+	configPath, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configPath, credentialsFile), nil
+}
+
+// LoadCredentials returns the stored credentials, or nil if not logged in
+func LoadCredentials() (*Credentials, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil || creds.APIKey == "" {
+		return nil, fmt.Errorf("invalid credentials file %s - run \"storageto login\" again", path)
+	}
+	return &creds, nil
+}
+
+// SaveCredentials stores credentials readable only by the current user
+func SaveCredentials(creds *Credentials) error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// DeleteCredentials removes stored credentials. It reports whether there were any.
+func DeleteCredentials() (bool, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return false, err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetAPIKey returns the API key from $STORAGETO_API_KEY or stored
+// credentials, or "" when not logged in
+func GetAPIKey() (string, error) {
+	if key := os.Getenv(APIKeyEnv); key != "" {
+		return key, nil
+	}
+	creds, err := LoadCredentials()
+	if err != nil || creds == nil {
+		return "", err
+	}
+	return creds.APIKey, nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const settingsFile = "config.json"
+
+// Settings are defaults for command-line flags, read from config.json in the
+// config directory. Zero values leave the built-in defaults in place and
+// flags given on the command line always win.
+type Settings struct {
+	ParallelFiles    int `json:"parallel_files,omitempty"`
+	ParallelParts    int `json:"parallel_parts,omitempty"`
+	BatchSize        int `json:"batch_size,omitempty"`
+	PartURLBatchSize int `json:"part_url_batch_size,omitempty"`
+	// PartSize is the multipart part size such as "64MB"
+	PartSize string `json:"part_size,omitempty"`
+	// LimitRate is a bandwidth limit such as "5MB/s"
+	LimitRate string `json:"limit_rate,omitempty"`
+}
+
+// SettingsPath returns where settings are read from
+func SettingsPath() (string, error) {
+	configPath, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configPath, settingsFile), nil
+}
+
+// LoadSettings reads config.json. A missing file yields zero Settings.
+func LoadSettings() (*Settings, error) {
+	path, err := SettingsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Settings{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var settings Settings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return &settings, nil
+}
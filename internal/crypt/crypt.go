@@ -0,0 +1,479 @@
+// Package crypt implements the client-side encryption format used by
+// "storageto upload --encrypt".
+//
+// An encrypted blob is a header followed by chunks:
+//
+//	header: magic "STO-ENC1" | chunk size (uint32 BE) | nonce prefix (7 bytes)
+//	chunk:  AES-256-GCM(plaintext[i*size:(i+1)*size]) with a 16-byte tag
+//
+// Each chunk is sealed on its own with nonce = prefix | index (uint32 BE) |
+// last flag, and the header as additional data. Because chunks are
+// independent, any byte range of the ciphertext can be produced from the
+// matching plaintext range, so encrypted files upload in parallel parts of
+// any size. The last flag detects truncation.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// KeySize is the length of an encryption key in bytes
+	KeySize = 32
+	// Suffix is appended to the names of encrypted files
+	Suffix = ".enc"
+
+	magic       = "STO-ENC1"
+	prefixSize  = 7
+	headerSize  = 8 + 4 + prefixSize // magic, chunk size, nonce prefix
+	chunkSize   = 64 * 1024
+	tagSize     = 16
+	sealedChunk = chunkSize + tagSize
+)
+
+// ErrInvalid is returned when data is not a valid encrypted blob or was
+// encrypted with a different key
+var ErrInvalid = errors.New("not encrypted with this key or data is corrupt")
+
+// GenerateKey returns a new random key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncodeKey formats a key for use in a URL fragment or on the command line
+func EncodeKey(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// DecodeKey parses a key produced by EncodeKey
+func DecodeKey(s string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("invalid encryption key")
+	}
+	return key, nil
+}
+
+// EncryptedSize returns the size of the ciphertext for size bytes of plaintext
+func EncryptedSize(size int64) int64 {
+	return headerSize + size + numChunks(size)*tagSize
+}
+
+func numChunks(size int64) int64 {
+	if size == 0 {
+		return 1 // An empty input still gets one (empty) final chunk
+	}
+	return (size + chunkSize - 1) / chunkSize
+}
+
+// sealer holds the per-blob state shared by the encrypting readers
+type sealer struct {
+	aead   cipher.AEAD
+	header []byte
+}
+
+func newSealer(key []byte, header []byte) (*sealer, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid encryption key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead, header: header}, nil
+}
+
+func newHeader() ([]byte, error) {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[len(magic):], chunkSize)
+	if _, err := rand.Read(header[len(magic)+4:]); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func (s *sealer) nonce(index int64, last bool) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	copy(nonce, s.header[len(magic)+4:])
+	binary.BigEndian.PutUint32(nonce[prefixSize:], uint32(index))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func (s *sealer) seal(dst, plain []byte, index int64, last bool) []byte {
+	return s.aead.Seal(dst, s.nonce(index, last), plain, s.header)
+}
+
+func (s *sealer) open(dst, sealed []byte, index int64, last bool) ([]byte, error) {
+	plain, err := s.aead.Open(dst, s.nonce(index, last), sealed, s.header)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return plain, nil
+}
+
+// ReaderAt encrypts a plaintext io.ReaderAt on demand, exposing the
+// ciphertext as an io.ReaderAt. It is safe for concurrent use.
+//
+// Sealing a chunk again must give the same ciphertext, or the nonce is
+// reused with different plaintext. So reads fail with ErrChanged when the
+// source is an *os.File that changed since NewReaderAt, and recently sealed
+// chunks are kept, so reads smaller than a chunk don't seal it again.
+type ReaderAt struct {
+	s     *sealer
+	src   io.ReaderAt
+	size  int64 // Plaintext size
+	total int64 // Ciphertext size
+	file  *os.File
+	stat  os.FileInfo // Of file when the ReaderAt was created
+
+	mu     sync.Mutex
+	recent []*sealedChunkBuf // Oldest first
+}
+
+// ErrChanged is returned by ReaderAt when its source changed while being
+// encrypted
+var ErrChanged = errors.New("file changed while it was being encrypted")
+
+// recentChunks is how many sealed chunks a ReaderAt keeps, enough for
+// several parts read at once
+const recentChunks = 16
+
+// sealedChunkBuf is a sealed chunk in a buffer from chunkBufs
+type sealedChunkBuf struct {
+	index int64
+	data  []byte
+	buf   *[]byte
+}
+
+// chunkBufs holds buffers large enough for a sealed chunk
+var chunkBufs = sync.Pool{
+	New: func() any {
+		buf := make([]byte, sealedChunk)
+		return &buf
+	},
+}
+
+// NewReaderAt returns an encrypting view of the first size bytes of src
+func NewReaderAt(key []byte, src io.ReaderAt, size int64) (*ReaderAt, error) {
+	header, err := newHeader()
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSealer(key, header)
+	if err != nil {
+		return nil, err
+	}
+	r := &ReaderAt{s: s, src: src, size: size, total: EncryptedSize(size)}
+	if file, ok := src.(*os.File); ok {
+		if r.stat, err = file.Stat(); err != nil {
+			return nil, err
+		}
+		r.file = file
+	}
+	return r, nil
+}
+
+// Size returns the size of the ciphertext
+func (r *ReaderAt) Size() int64 {
+	return r.total
+}
+
+// ReadAt implements io.ReaderAt over the ciphertext
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.total {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < r.total {
+		if off < headerSize {
+			c := copy(p[n:], r.s.header[off:])
+			n += c
+			off += int64(c)
+			continue
+		}
+
+		index := (off - headerSize) / sealedChunk
+		within := (off - headerSize) % sealedChunk
+		c, err := r.readChunk(p[n:], index, within)
+		if err != nil {
+			return n, err
+		}
+		n += c
+		off += int64(c)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readChunk copies sealed chunk index into p, starting within bytes into it
+func (r *ReaderAt) readChunk(p []byte, index, within int64) (int, error) {
+	r.mu.Lock()
+	for _, c := range r.recent {
+		if c.index == index {
+			n := copy(p, c.data[within:])
+			r.mu.Unlock()
+			return n, nil
+		}
+	}
+	r.mu.Unlock()
+
+	c, err := r.seal(index)
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, c.data[within:])
+	r.keep(c)
+	return n, nil
+}
+
+// seal reads and encrypts chunk index
+func (r *ReaderAt) seal(index int64) (*sealedChunkBuf, error) {
+	start := index * chunkSize
+	length := min64(chunkSize, r.size-start)
+
+	plain := chunkBufs.Get().(*[]byte)
+	defer chunkBufs.Put(plain)
+	n, err := r.src.ReadAt((*plain)[:length], start)
+	if int64(n) < length {
+		if err == io.EOF {
+			err = ErrChanged // The file got shorter
+		}
+		return nil, err
+	}
+	if r.file != nil {
+		stat, err := r.file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if stat.Size() != r.stat.Size() || !stat.ModTime().Equal(r.stat.ModTime()) {
+			return nil, ErrChanged
+		}
+	}
+
+	buf := chunkBufs.Get().(*[]byte)
+	data := r.s.seal((*buf)[:0], (*plain)[:length], index, index == numChunks(r.size)-1)
+	return &sealedChunkBuf{index: index, data: data, buf: buf}, nil
+}
+
+// keep adds c to the recently sealed chunks, recycling the oldest
+func (r *ReaderAt) keep(c *sealedChunkBuf) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.recent {
+		if other.index == c.index {
+			chunkBufs.Put(c.buf) // Sealed by a concurrent read as well
+			return
+		}
+	}
+	if len(r.recent) == recentChunks {
+		chunkBufs.Put(r.recent[0].buf)
+		r.recent = append(r.recent[:0], r.recent[1:]...)
+	}
+	r.recent = append(r.recent, c)
+}
+
+// NewReader returns a reader that encrypts everything read from r. Use it
+// for streams of unknown length; the output is identical in format to ReaderAt.
+func NewReader(key []byte, r io.Reader) (io.Reader, error) {
+	header, err := newHeader()
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSealer(key, header)
+	if err != nil {
+		return nil, err
+	}
+	return &encReader{s: s, src: r, out: append([]byte(nil), header...)}, nil
+}
+
+type encReader struct {
+	s     *sealer
+	src   io.Reader
+	out   []byte // Ciphertext ready to be read
+	next  []byte // Plaintext read ahead of the current chunk
+	index int64
+	done  bool
+}
+
+func (e *encReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// fill seals the next chunk. One extra byte is read ahead to find out
+// whether the chunk is the last one.
+func (e *encReader) fill() error {
+	buf := make([]byte, chunkSize+1)
+	n := copy(buf, e.next)
+	m, err := io.ReadFull(e.src, buf[n:])
+	n += m
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	last := n <= chunkSize
+	chunk := buf[:min64(int64(n), chunkSize)]
+	if last {
+		e.next = nil
+		e.done = true
+	} else {
+		e.next = buf[chunkSize:n]
+	}
+
+	e.out = e.s.seal(nil, chunk, e.index, last)
+	e.index++
+	return nil
+}
+
+// NewDecryptingReader returns a reader that decrypts a blob produced by
+// ReaderAt or NewReader. Reads fail with ErrInvalid if the key is wrong or
+// the data was modified or truncated.
+func NewDecryptingReader(key []byte, r io.Reader) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrInvalid
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) || binary.BigEndian.Uint32(header[len(magic):]) != chunkSize {
+		return nil, ErrInvalid
+	}
+	s, err := newSealer(key, header)
+	if err != nil {
+		return nil, err
+	}
+	return &decReader{s: s, src: r}, nil
+}
+
+type decReader struct {
+	s     *sealer
+	src   io.Reader
+	out   []byte
+	next  []byte
+	index int64
+	done  bool
+}
+
+func (d *decReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *decReader) fill() error {
+	buf := make([]byte, sealedChunk+1)
+	n := copy(buf, d.next)
+	m, err := io.ReadFull(d.src, buf[n:])
+	n += m
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	last := n <= sealedChunk
+	chunk := buf[:min64(int64(n), sealedChunk)]
+	if last {
+		d.next = nil
+		d.done = true
+	} else {
+		d.next = buf[sealedChunk:n]
+	}
+
+	plain, err := d.s.open(nil, chunk, d.index, last)
+	if err != nil {
+		return err
+	}
+	d.out = plain
+	d.index++
+	return nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// DecryptFile decrypts the blob at src into dst. dst is only created once
+// decryption has succeeded completely, and only the user can read it.
+func DecryptFile(key []byte, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dr, err := NewDecryptingReader(key, in)
+	if err != nil {
+		return err
+	}
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// A leftover temp file keeps its mode, so set it in any case
+	err = out.Chmod(0600)
+	if err == nil {
+		_, err = io.Copy(out, dr)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// DecryptedName returns the name for the decrypted copy of an encrypted file
+func DecryptedName(name string) string {
+	if strings.HasSuffix(name, Suffix) && len(name) > len(Suffix) {
+		return strings.TrimSuffix(name, Suffix)
+	}
+	return name + ".dec"
+}
@@ -0,0 +1,214 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		// ReaderAt, read through an odd-sized section like a multipart part
+		ra, err := NewReaderAt(key, bytes.NewReader(plain), int64(size))
+		if err != nil {
+			t.Fatalf("NewReaderAt() error = %v", err)
+		}
+		if ra.Size() != EncryptedSize(int64(size)) {
+			t.Errorf("Size() = %d, want %d", ra.Size(), EncryptedSize(int64(size)))
+		}
+		var sealed bytes.Buffer
+		for off := int64(0); off < ra.Size(); off += 12345 {
+			n := min64(12345, ra.Size()-off)
+			io.Copy(&sealed, io.NewSectionReader(ra, off, n))
+		}
+		if int64(sealed.Len()) != ra.Size() {
+			t.Fatalf("size %d: read %d ciphertext bytes, want %d", size, sealed.Len(), ra.Size())
+		}
+		checkDecrypt(t, key, sealed.Bytes(), plain)
+
+		// Streaming reader
+		er, err := NewReader(key, bytes.NewReader(plain))
+		if err != nil {
+			t.Fatalf("NewReader() error = %v", err)
+		}
+		streamed, err := io.ReadAll(er)
+		if err != nil {
+			t.Fatalf("size %d: stream encrypt error = %v", size, err)
+		}
+		if int64(len(streamed)) != EncryptedSize(int64(size)) {
+			t.Errorf("size %d: streamed %d bytes, want %d", size, len(streamed), EncryptedSize(int64(size)))
+		}
+		checkDecrypt(t, key, streamed, plain)
+	}
+}
+
+func checkDecrypt(t *testing.T, key, sealed, want []byte) {
+	t.Helper()
+	dr, err := NewDecryptingReader(key, bytes.NewReader(sealed))
+	if err != nil {
+		t.Fatalf("NewDecryptingReader() error = %v", err)
+	}
+	got, err := io.ReadAll(dr)
+	if err != nil {
+		t.Fatalf("decrypt error = %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("decrypted %d bytes, does not match %d byte plaintext", len(got), len(want))
+	}
+}
+
+func TestDecryptFile(t *testing.T) {
+	key, _ := GenerateKey()
+	otherKey, _ := GenerateKey()
+	plain := []byte("secret report")
+	er, _ := NewReader(key, bytes.NewReader(plain))
+	sealed, _ := io.ReadAll(er)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "report.txt"+Suffix)
+	if err := os.WriteFile(src, sealed, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "report.txt")
+	if err := DecryptFile(otherKey, src, dst); err == nil {
+		t.Error("DecryptFile() with the wrong key should fail")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("failed DecryptFile() left %s: %v", dst, err)
+	}
+
+	if err := DecryptFile(key, src, dst); err != nil {
+		t.Fatalf("DecryptFile() error = %v", err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, plain) {
+		t.Errorf("decrypted %q, want %q", got, plain)
+	}
+	if runtime.GOOS != "windows" {
+		if stat, _ := os.Stat(dst); stat.Mode().Perm() != 0600 {
+			t.Errorf("decrypted file mode = %v, want 0600", stat.Mode().Perm())
+		}
+	}
+}
+
+func TestTamperDetection(t *testing.T) {
+	key, _ := GenerateKey()
+	otherKey, _ := GenerateKey()
+	plain := make([]byte, 2*chunkSize+100)
+	er, _ := NewReader(key, bytes.NewReader(plain))
+	sealed, _ := io.ReadAll(er)
+
+	tests := map[string]struct {
+		key  []byte
+		data []byte
+	}{
+		"wrong key": {otherKey, sealed},
+		"truncated": {key, sealed[:headerSize+sealedChunk]},
+		"modified":  {key, append(append([]byte(nil), sealed[:100]...), append([]byte{sealed[100] ^ 1}, sealed[101:]...)...)},
+	}
+	for name, tt := range tests {
+		dr, err := NewDecryptingReader(tt.key, bytes.NewReader(tt.data))
+		if err == nil {
+			_, err = io.ReadAll(dr)
+		}
+		if err == nil {
+			t.Errorf("%s: decrypt should fail", name)
+		}
+	}
+}
+
+func TestReaderAtConcurrent(t *testing.T) {
+	key, _ := GenerateKey()
+	plain := make([]byte, 40*chunkSize+5)
+	rand.Read(plain)
+	ra, _ := NewReaderAt(key, bytes.NewReader(plain), int64(len(plain)))
+
+	// Parts read in small pieces at once, as uploads do
+	sealed := make([]byte, ra.Size())
+	var wg sync.WaitGroup
+	for off := int64(0); off < ra.Size(); off += 300000 {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			part := sealed[off : off+min64(300000, ra.Size()-off)]
+			for read := 0; read < len(part); read += 4096 {
+				if _, err := ra.ReadAt(part[read:min(read+4096, len(part))], off+int64(read)); err != nil {
+					t.Errorf("ReadAt() error = %v", err)
+					return
+				}
+			}
+		}(off)
+	}
+	wg.Wait()
+	checkDecrypt(t, key, sealed, plain)
+}
+
+func TestReaderAtChangedSource(t *testing.T) {
+	key, _ := GenerateKey()
+	plain := make([]byte, 3*chunkSize)
+
+	// The source is shorter than promised
+	ra, _ := NewReaderAt(key, bytes.NewReader(plain[:chunkSize]), int64(len(plain)))
+	if _, err := io.ReadAll(io.NewSectionReader(ra, 0, ra.Size())); !errors.Is(err, ErrChanged) {
+		t.Errorf("short source: error = %v, want ErrChanged", err)
+	}
+
+	// The file is rewritten after the first chunk was read
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, plain, 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+	ra, err = NewReaderAt(key, file, int64(len(plain)))
+	if err != nil {
+		t.Fatalf("NewReaderAt() error = %v", err)
+	}
+	buf := make([]byte, 100)
+	if _, err := ra.ReadAt(buf, headerSize); err != nil {
+		t.Fatalf("ReadAt() error = %v", err)
+	}
+	os.WriteFile(path, bytes.Repeat([]byte{1}, len(plain)), 0644)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path, later, later)
+
+	// The chunk already sealed is served as before, others are refused
+	if _, err := ra.ReadAt(buf, headerSize+100); err != nil {
+		t.Errorf("ReadAt() of a sealed chunk error = %v", err)
+	}
+	if _, err := ra.ReadAt(buf, headerSize+sealedChunk); !errors.Is(err, ErrChanged) {
+		t.Errorf("changed file: error = %v, want ErrChanged", err)
+	}
+}
+
+func TestKeyEncoding(t *testing.T) {
+	key, _ := GenerateKey()
+	decoded, err := DecodeKey(EncodeKey(key))
+	if err != nil {
+		t.Fatalf("DecodeKey() error = %v", err)
+	}
+	if !bytes.Equal(decoded, key) {
+		t.Error("key changed after encode/decode")
+	}
+	if _, err := DecodeKey("short"); err == nil {
+		t.Error("DecodeKey() should reject invalid keys")
+	}
+}
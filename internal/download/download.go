@@ -0,0 +1,342 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/crypt"
+	"github.com/storageto/cli/internal/progress"
+	"github.com/storageto/cli/internal/version"
+)
+
+const (
+	// DefaultConcurrentFiles is the same limit as for concurrent uploads
+	DefaultConcurrentFiles = 6
+	MaxConcurrentFiles     = 32
+	partialSuffix          = ".part"
+	etagSuffix             = ".etag" // Added to a partial file's name to keep its ETag
+)
+
+// Options configures a Downloader
+type Options struct {
+	Verbose bool
+	// OutputDir is where files are written; relative paths inside
+	// collections are recreated below it
+	OutputDir string
+	// Key decrypts downloads of encrypted uploads. A key in the link's
+	// URL fragment is used when this is nil.
+	Key []byte
+	// ConcurrentFiles limits how many files of a collection are fetched at
+	// once, up to MaxConcurrentFiles. Zero means DefaultConcurrentFiles.
+	ConcurrentFiles int
+	// Progress shows the progress of downloads and messages about them.
+	// Nothing is shown if it is nil.
+	Progress *progress.Display
+}
+
+// rawClient fetches raw files. Raw links redirect to storage, which must
+// not see the share password, so it is dropped when the host changes.
+var rawClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if req.URL.Host != via[0].URL.Host {
+			req.Header.Del(api.SharePasswordHeader)
+		}
+		return nil
+	},
+}
+
+// Downloader fetches files and collections from storage.to
+type Downloader struct {
+	client *api.Client
+	opts   Options
+}
+
+// NewDownloader creates a new downloader
+func NewDownloader(client *api.Client, opts Options) *Downloader {
+	if opts.OutputDir == "" {
+		opts.OutputDir = "."
+	}
+	switch {
+	case opts.ConcurrentFiles == 0:
+		opts.ConcurrentFiles = DefaultConcurrentFiles
+	case opts.ConcurrentFiles < 1:
+		opts.ConcurrentFiles = 1
+	case opts.ConcurrentFiles > MaxConcurrentFiles:
+		opts.ConcurrentFiles = MaxConcurrentFiles
+	}
+	return &Downloader{
+		client: client,
+		opts:   opts,
+	}
+}
+
+// Download fetches the file or every file of the collection ref points at
+// and returns the local paths written
+func (d *Downloader) Download(ctx context.Context, ref api.Ref) ([]string, error) {
+	key := d.opts.Key
+	if key == nil && ref.Key != "" {
+		var err error
+		key, err = crypt.DecodeKey(ref.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ref.Kind == api.RefCollection {
+		return d.downloadCollection(ctx, ref.ID, key)
+	}
+
+	resp, err := d.client.GetFile(ctx, ref.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up file: %w", err)
+	}
+	transfer := d.opts.Progress.Group(1, resp.File.Size)
+	dest, err := d.fetchFile(ctx, resp.File, key, transfer)
+	transfer.Done("Downloaded")
+	if err != nil {
+		return nil, err
+	}
+	return []string{dest}, nil
+}
+
+// downloadCollection fetches all files of a collection concurrently
+func (d *Downloader) downloadCollection(ctx context.Context, id string, key []byte) ([]string, error) {
+	manifest, err := d.client.GetCollectionManifest(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch collection: %w", err)
+	}
+	d.opts.Progress.Printf("Downloading %d files...\n", len(manifest.Files))
+
+	var total int64
+	for _, f := range manifest.Files {
+		total += f.Size
+	}
+	transfer := d.opts.Progress.Group(len(manifest.Files), total)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, d.opts.ConcurrentFiles)
+	paths := make([]string, len(manifest.Files))
+	var firstErr atomic.Value
+
+	for i := range manifest.Files {
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		sem <- struct{}{} // Acquire
+
+		go func(i int, f *api.FileInfo) {
+			defer wg.Done()
+			defer func() { <-sem }() // Release
+
+			dest, err := d.fetchFile(ctx, f, key, transfer)
+			if err != nil {
+				firstErr.CompareAndSwap(nil, fmt.Errorf("%s: %w", f.Filename, err))
+				return
+			}
+			paths[i] = dest
+		}(i, &manifest.Files[i])
+	}
+	wg.Wait()
+	transfer.Done("Downloaded")
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("download cancelled")
+	}
+	if err := firstErr.Load(); err != nil {
+		return nil, err.(error)
+	}
+	return paths, nil
+}
+
+// fetchFile downloads one file as part of transfer, resuming a partial
+// download left by an earlier attempt. The data goes to a ".part" file that
+// is renamed on success. With a key, the file is decrypted afterwards and the
+// ciphertext removed.
+func (d *Downloader) fetchFile(ctx context.Context, f *api.FileInfo, key []byte, transfer *progress.Group) (string, error) {
+	task := transfer.Start(f.Filename, f.Size)
+	dest, err := d.fetchRaw(ctx, f, task)
+	if err != nil {
+		task.Fail(err)
+	} else {
+		task.Done()
+	}
+	if err != nil || key == nil {
+		return dest, err
+	}
+
+	plain := crypt.DecryptedName(dest)
+	if err := crypt.DecryptFile(key, dest, plain); err != nil {
+		return "", fmt.Errorf("cannot decrypt %s: %w", f.Filename, err)
+	}
+	os.Remove(dest)
+	return plain, nil
+}
+
+// fetchRaw downloads the stored bytes of a file, reporting progress to task
+func (d *Downloader) fetchRaw(ctx context.Context, f *api.FileInfo, task *progress.Task) (string, error) {
+	dest, err := localPath(d.opts.OutputDir, f.Filename)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+
+	rawURL := f.RawURL
+	if rawURL == "" {
+		rawURL = d.client.BaseURL + "/r/" + f.ID
+	}
+
+	// A partial file is only continued if the server can tell from its ETag
+	// that the file did not change since
+	partial := dest + partialSuffix
+	etagFile := partial + etagSuffix
+	var offset int64
+	var etag string
+	if stat, err := os.Stat(partial); err == nil {
+		if data, err := os.ReadFile(etagFile); err == nil {
+			offset = stat.Size()
+			etag = string(data)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	if d.client.SharePassword != "" {
+		req.Header.Set(api.SharePasswordHeader, d.client.SharePassword)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", etag)
+		d.log("Resuming %s at %s\n", f.Filename, progress.HumanSize(offset))
+	}
+
+	resp, err := rawClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("download cancelled")
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		if offset != f.Size {
+			// The partial file is longer than the file, start over
+			os.Remove(partial)
+			os.Remove(etagFile)
+			return d.fetchRaw(ctx, f, task)
+		}
+		// The partial file is already complete
+		task.Skip(offset)
+		os.Remove(etagFile)
+		return dest, os.Rename(partial, dest)
+	case resp.StatusCode >= 400:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		apiErr := api.ErrorFromResponse(resp, body)
+		if (apiErr.Code == api.CodeUnauthorized || apiErr.Code == api.CodeForbidden) && d.client.SharePassword == "" {
+			apiErr.Code = api.CodePasswordRequired
+			apiErr.Message = f.Filename + " is password protected - use --password"
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(fmt.Sprintf("download failed (HTTP %d): %s", resp.StatusCode, body))
+			apiErr.Message = strings.TrimSuffix(apiErr.Message, ":")
+		}
+		return "", apiErr
+	default:
+		// The file changed or the server ignored the Range header, start over
+		flags |= os.O_TRUNC
+		offset = 0
+		if err := saveETag(etagFile, resp.Header.Get("ETag")); err != nil {
+			return "", err
+		}
+	}
+
+	out, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return "", err
+	}
+	var reported int64
+
+	task.Skip(offset)
+	pr := &progress.Reader{
+		Reader: resp.Body,
+		OnProgress: func(done, _ int64) {
+			task.Add(done - reported)
+			reported = done
+		},
+	}
+
+	_, err = io.Copy(out, pr)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("download cancelled")
+		}
+		return "", fmt.Errorf("download interrupted: %w", err)
+	}
+
+	if err := os.Rename(partial, dest); err != nil {
+		return "", err
+	}
+	os.Remove(etagFile)
+	return dest, nil
+}
+
+// saveETag records the ETag a download started with, so it can be resumed
+// with If-Range. Weak ETags can't be used there and are not kept.
+func saveETag(path, etag string) error {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(etag), 0644)
+}
+
+// localPath maps a (possibly nested) filename from the server to a path
+// below dir, refusing names that would escape it
+func localPath(dir, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	for _, elem := range strings.Split(slashed, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("refusing unsafe filename %q", name)
+		}
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+slashed), "/")
+	if rel == "" {
+		return "", fmt.Errorf("refusing unsafe filename %q", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel)), nil
+}
+
+func (d *Downloader) log(format string, args ...interface{}) {
+	if d.opts.Verbose {
+		d.opts.Progress.Printf(format, args...)
+	}
+}
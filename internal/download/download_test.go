@@ -0,0 +1,159 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"photo.jpg", filepath.Join("out", "photo.jpg")},
+		{"src/pkg/a.go", filepath.Join("out", "src", "pkg", "a.go")},
+		{"/abs/file.txt", filepath.Join("out", "abs", "file.txt")},
+		{`win\style.txt`, filepath.Join("out", "win", "style.txt")},
+	}
+	for _, tt := range tests {
+		got, err := localPath("out", tt.name)
+		if err != nil {
+			t.Errorf("localPath(%q) error = %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("localPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "../etc/passwd", "a/../../b", "/"} {
+		if _, err := localPath("out", bad); err == nil {
+			t.Errorf("localPath(%q) should fail", bad)
+		}
+	}
+}
+
+func TestFetchRawRedirect(t *testing.T) {
+	var storagePassword, apiPassword string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storagePassword = r.Header.Get(api.SharePasswordHeader)
+		w.Write([]byte("content"))
+	}))
+	defer storage.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiPassword = r.Header.Get(api.SharePasswordHeader)
+		if r.URL.Path == "/r/F1" {
+			http.Redirect(w, r, "/r/F1/blob", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, storage.URL+"/blob", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	client := api.NewClient(srv.URL, "")
+	client.SharePassword = "secret"
+	d := NewDownloader(client, Options{OutputDir: t.TempDir()})
+	dest, err := d.fetchRaw(context.Background(), &api.FileInfo{ID: "F1", Filename: "a.txt", Size: 7}, nil)
+	if err != nil {
+		t.Fatalf("fetchRaw() error = %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "content" {
+		t.Errorf("downloaded %q, want content", data)
+	}
+	if apiPassword != "secret" {
+		t.Errorf("redirect on the same host got password %q, want it kept", apiPassword)
+	}
+	if storagePassword != "" {
+		t.Errorf("storage got password %q, want none", storagePassword)
+	}
+}
+
+func TestFetchRawResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		partial   string // Content of the .part file, if any
+		etag      string // ETag stored for it, if any
+		wantRange string
+	}{
+		{"fresh", "", "", ""},
+		{"unchanged", "con", `"v1"`, "bytes=3-"},
+		{"changed", "old", `"v0"`, "bytes=3-"},
+		{"no etag", "con", "", ""},
+		{"complete", "content", `"v1"`, "bytes=7-"},
+		{"longer than the file", "content and more", `"v1"`, "bytes=16-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges, ifRanges []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ranges = append(ranges, r.Header.Get("Range"))
+				ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+				w.Header().Set("ETag", `"v1"`)
+				http.ServeContent(w, r, "", time.Time{}, strings.NewReader("content"))
+			}))
+			defer srv.Close()
+
+			dir := t.TempDir()
+			partial := filepath.Join(dir, "a.txt"+partialSuffix)
+			if tt.partial != "" {
+				os.WriteFile(partial, []byte(tt.partial), 0644)
+			}
+			if tt.etag != "" {
+				os.WriteFile(partial+etagSuffix, []byte(tt.etag), 0644)
+			}
+
+			d := NewDownloader(api.NewClient(srv.URL, ""), Options{OutputDir: dir})
+			dest, err := d.fetchRaw(context.Background(), &api.FileInfo{ID: "F1", Filename: "a.txt", Size: 7}, nil)
+			if err != nil {
+				t.Fatalf("fetchRaw() error = %v", err)
+			}
+			if data, _ := os.ReadFile(dest); string(data) != "content" {
+				t.Errorf("downloaded %q, want content", data)
+			}
+			if ranges[0] != tt.wantRange {
+				t.Errorf("Range = %q, want %q", ranges[0], tt.wantRange)
+			}
+			if tt.wantRange != "" && ifRanges[0] != tt.etag {
+				t.Errorf("If-Range = %q, want %q", ifRanges[0], tt.etag)
+			}
+			for _, name := range []string{partial, partial + etagSuffix} {
+				if _, err := os.Stat(name); !os.IsNotExist(err) {
+					t.Errorf("%s left behind: %v", filepath.Base(name), err)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchRawKeepsETag(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Length", "7")
+		w.Write([]byte("con"))
+		w.(http.Flusher).Flush()
+		// Drop the connection halfway
+		panic(http.ErrAbortHandler)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d := NewDownloader(api.NewClient(srv.URL, ""), Options{OutputDir: dir})
+	if _, err := d.fetchRaw(context.Background(), &api.FileInfo{ID: "F1", Filename: "a.txt", Size: 7}, nil); err == nil {
+		t.Fatal("fetchRaw() succeeded, want it interrupted")
+	}
+	partial := filepath.Join(dir, "a.txt"+partialSuffix)
+	if data, _ := os.ReadFile(partial); string(data) != "con" {
+		t.Errorf("partial file = %q, want con", data)
+	}
+	if data, _ := os.ReadFile(partial + etagSuffix); string(data) != `"v1"` {
+		t.Errorf("stored ETag = %q, want \"v1\"", data)
+	}
+}
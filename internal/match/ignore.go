@@ -0,0 +1,148 @@
+package match
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Filter selects files by --include and --exclude patterns. Patterns without
+// a slash match the file's base name, others match the whole slash-separated
+// name. If Include is non-empty a file must match at least one include.
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// Validate checks that all patterns are well-formed
+func (f Filter) Validate() error {
+	for _, p := range append(append([]string(nil), f.Include...), f.Exclude...) {
+		if _, err := Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// Excluded reports whether name matches an exclude pattern
+func (f Filter) Excluded(name string) bool {
+	return matchAny(f.Exclude, name)
+}
+
+// Allowed reports whether a file called name passes the filter
+func (f Filter) Allowed(name string) bool {
+	if f.Excluded(name) {
+		return false
+	}
+	return len(f.Include) == 0 || matchAny(f.Include, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		target := name
+		if !strings.Contains(p, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Ignore holds gitignore-style rules collected from ignore files while
+// walking a directory tree. Rules only apply below the directory that
+// contains their ignore file, and later rules override earlier ones.
+type Ignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	base     string // Slash-separated dir of the ignore file, relative to the walk root
+	pattern  string
+	negate   bool // "!pattern" re-includes a previously ignored path
+	dirOnly  bool // "pattern/" only matches directories
+	anchored bool // Pattern contains a slash, so it matches relative to base
+}
+
+// AddFile loads rules from the ignore file at path. base is the directory
+// holding the file, relative to the walk root ("" for the root itself).
+// A missing file is not an error.
+func (ig *Ignore) AddFile(filePath, base string) error {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		ig.addLine(scanner.Text(), base)
+	}
+	return scanner.Err()
+}
+
+func (ig *Ignore) addLine(line, base string) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	r := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasPrefix(line, `\`) {
+		line = line[1:] // Escaped leading "#" or "!"
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return
+	}
+	if _, err := Match(line, ""); err != nil {
+		return // Skip malformed patterns like git does
+	}
+	r.pattern = line
+	ig.rules = append(ig.rules, r)
+}
+
+// Ignored reports whether the slash-separated path rel (relative to the walk
+// root) is ignored
+func (ig *Ignore) Ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range ig.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+
+		sub := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			sub = strings.TrimPrefix(rel, r.base+"/")
+		}
+
+		target := sub
+		if !r.anchored {
+			target = path.Base(sub)
+		}
+		if ok, _ := Match(r.pattern, target); ok {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
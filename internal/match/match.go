@@ -0,0 +1,118 @@
+package match
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Match reports whether a slash-separated name matches pattern. The syntax is
+// that of path.Match, plus "**" as a whole path element, which matches zero
+// or more directories (e.g. "src/**/*.go" matches "src/a.go" and "src/x/y/b.go").
+func Match(pattern, name string) (bool, error) {
+	// Validate all elements up front so bad patterns fail consistently
+	for _, elem := range strings.Split(pattern, "/") {
+		if elem == "**" {
+			continue
+		}
+		if _, err := path.Match(elem, ""); err != nil {
+			return false, err
+		}
+	}
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/")), nil
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated "**" and try every possible split point
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+// HasMeta reports whether pattern contains any glob metacharacters
+func HasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// GlobBase returns the longest leading directory of pattern without
+// metacharacters, which is where Glob starts looking for matches
+func GlobBase(pattern string) string {
+	slashPattern := filepath.ToSlash(pattern)
+	var baseElems []string
+	for _, elem := range strings.Split(slashPattern, "/") {
+		if HasMeta(elem) {
+			break
+		}
+		baseElems = append(baseElems, elem)
+	}
+	base := strings.Join(baseElems, "/")
+	if base == "" {
+		if strings.HasPrefix(slashPattern, "/") {
+			base = "/"
+		} else {
+			base = "."
+		}
+	}
+	return filepath.FromSlash(base)
+}
+
+// Glob returns the paths matching pattern, like filepath.Glob but with
+// support for "**". Matches are returned in lexical order.
+func Glob(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	slashPattern := filepath.ToSlash(pattern)
+	if _, err := Match(slashPattern, ""); err != nil {
+		return nil, err
+	}
+
+	base := filepath.ToSlash(GlobBase(pattern))
+	var matches []string
+	err := filepath.WalkDir(filepath.FromSlash(base), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries simply don't match, as with filepath.Glob
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		name := filepath.ToSlash(p)
+		if base == "." {
+			name = strings.TrimPrefix(name, "./")
+		}
+		if ok, _ := Match(slashPattern, name); ok {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
@@ -0,0 +1,126 @@
+package match
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "src/main.go", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "lib/main.go", false},
+		{"**/testdata", "a/b/testdata", true},
+		{"**/testdata", "testdata", true},
+		{"build/**", "build/x/y", true},
+		{"a/**/**/b", "a/b", true},
+		{"file?.txt", "file1.txt", true},
+		{"[ab].txt", "c.txt", false},
+	}
+
+	for _, tt := range tests {
+		got, err := Match(tt.pattern, tt.name)
+		if err != nil {
+			t.Errorf("Match(%q, %q) error = %v", tt.pattern, tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := Match("[", "x"); err == nil {
+		t.Error("Match() with bad pattern should return an error")
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"src/a.go", "src/pkg/b.go", "src/pkg/c.txt"} {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	matches, err := Glob(filepath.Join(tmpDir, "src", "**", "*.go"))
+	if err != nil {
+		t.Fatalf("Glob() error = %v", err)
+	}
+	want := []string{
+		filepath.Join(tmpDir, "src", "a.go"),
+		filepath.Join(tmpDir, "src", "pkg", "b.go"),
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("Glob() = %v, want %v", matches, want)
+	}
+	for i := range want {
+		if matches[i] != want[i] {
+			t.Errorf("Glob()[%d] = %q, want %q", i, matches[i], want[i])
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := Filter{
+		Include: []string{"*.go", "docs/**"},
+		Exclude: []string{"*_test.go"},
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"src/main.go", true},
+		{"src/main_test.go", false},
+		{"docs/guide/index.md", true},
+		{"README.md", false},
+	}
+	for _, tt := range tests {
+		if got := f.Allowed(tt.name); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	var ig Ignore
+	for _, line := range []string{
+		"# comment",
+		"*.log",
+		"!keep.log",
+		"node_modules/",
+		"/dist",
+	} {
+		ig.addLine(line, "")
+	}
+	ig.addLine("*.tmp", "sub")
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"debug.log", false, true},
+		{"a/b/debug.log", false, true},
+		{"a/keep.log", false, false},
+		{"node_modules", true, true},
+		{"node_modules", false, false},
+		{"dist", true, true},
+		{"a/dist", true, false},
+		{"sub/x.tmp", false, true},
+		{"other/x.tmp", false, false},
+	}
+	for _, tt := range tests {
+		if got := ig.Ignored(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
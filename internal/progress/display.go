@@ -0,0 +1,617 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Mode selects how a Display shows progress
+type Mode string
+
+const (
+	Auto  Mode = ""      // Bar on a terminal, Plain otherwise
+	Bar   Mode = "bar"   // Bars for each file and the total, redrawn in place
+	Plain Mode = "plain" // A status line every PlainInterval, for logs and CI
+	None  Mode = "none"  // Messages only
+	JSON  Mode = "json"  // A line of JSON per Event, for other programs
+	Quiet Mode = "quiet" // Nothing but warnings
+)
+
+// Modes lists the modes that can be chosen with --progress
+var Modes = []Mode{Plain, Bar, None, JSON}
+
+// ParseMode parses a --progress value
+func ParseMode(s string) (Mode, error) {
+	for _, m := range Modes {
+		if Mode(s) == m {
+			return m, nil
+		}
+	}
+	names := make([]string, len(Modes))
+	for i, m := range Modes {
+		names[i] = string(m)
+	}
+	return "", fmt.Errorf("unknown progress mode %q - use %s", s, strings.Join(names, ", "))
+}
+
+const (
+	barInterval = 100 * time.Millisecond
+	rateWindow  = 5 * time.Second
+	maxBars     = 8 // Files shown at once, the rest are summed up
+
+	// Widths of a bar line: the fixed part around name and bar, the speed
+	// shown for single files and the bar's bounds
+	barFixedWidth = 35
+	barSpeedWidth = 24
+	minBarWidth   = 5
+	maxBarWidth   = 30
+)
+
+// PlainInterval is how often Plain mode prints a status line
+var PlainInterval = 10 * time.Second
+
+// Display shows the progress of transfers along with messages about them.
+// One goroutine owns the writer, so any number of goroutines can report
+// progress and print without clobbering each other's lines. A nil Display
+// shows nothing.
+type Display struct {
+	w    io.Writer
+	mode Mode
+
+	mu     sync.Mutex
+	group  *Group // Transfer in progress, if any
+	status string // Transient line, see SetStatus
+
+	msgs  chan string
+	quit  chan struct{}
+	done  chan struct{}
+	drawn int // Lines of bars on screen
+}
+
+// New starts a Display writing to w, which is usually os.Stderr. Auto
+// picks Bar if w is a terminal. Stop must be called when done.
+func New(w io.Writer, mode Mode) *Display {
+	if mode == Auto {
+		mode = Plain
+		if isTerminal(w) {
+			mode = Bar
+		}
+	}
+	d := &Display{
+		w:    w,
+		mode: mode,
+		msgs: make(chan string),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// isTerminal reports whether w is a terminal that understands the escape
+// codes used to redraw bars. The Windows console only does when enabled,
+// so it gets plain lines.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || runtime.GOOS == "windows" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Stop clears any bars and stops the Display. Messages printed later are
+// written directly.
+func (d *Display) Stop() {
+	if d == nil {
+		return
+	}
+	select {
+	case <-d.quit:
+	default:
+		close(d.quit)
+	}
+	<-d.done
+}
+
+// Printf prints an informational message, unless the Display is Quiet. In
+// JSON mode it becomes a Message event.
+func (d *Display) Printf(format string, args ...interface{}) {
+	if d == nil || d.mode == Quiet {
+		return
+	}
+	d.printAs(Message, fmt.Sprintf(format, args...))
+}
+
+// Warnf prints a message that is shown even when the Display is Quiet. In
+// JSON mode it becomes a Warning event.
+func (d *Display) Warnf(format string, args ...interface{}) {
+	if d == nil {
+		return
+	}
+	d.printAs(Warning, fmt.Sprintf(format, args...))
+}
+
+// SetStatus shows a transient line such as a countdown, replacing the
+// previous one; "" removes it. Bar mode redraws it in place below the bars.
+// The other modes print it as a message when it appears, and Plain mode
+// again with every status line, as they can't update it. Quiet mode shows
+// nothing.
+func (d *Display) SetStatus(text string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	appeared := d.status == "" && text != ""
+	d.status = text
+	d.mu.Unlock()
+	if appeared && d.mode != Bar && d.mode != Quiet {
+		d.printAs(Message, text+"\n")
+	}
+}
+
+func (d *Display) printAs(typ EventType, text string) {
+	if d.mode == JSON {
+		text = encode(Event{Type: typ, Message: strings.TrimSpace(text)})
+	}
+	d.print(text)
+}
+
+// print hands text to the goroutine that owns the writer and waits until
+// it is written
+func (d *Display) print(text string) {
+	select {
+	case d.msgs <- text:
+	case <-d.done:
+		io.WriteString(d.w, text)
+	}
+}
+
+func (d *Display) run() {
+	defer close(d.done)
+
+	var tick <-chan time.Time
+	switch d.mode {
+	case Bar:
+		ticker := time.NewTicker(barInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	case Plain:
+		ticker := time.NewTicker(PlainInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	case JSON:
+		ticker := time.NewTicker(jsonInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case text := <-d.msgs:
+			d.write(text, true)
+		case now := <-tick:
+			g, status := d.current()
+			if g != nil {
+				g.sample(now)
+			}
+			switch {
+			case d.mode == Plain:
+				var text string
+				if g != nil {
+					text = g.status() + "\n"
+				}
+				if status != "" {
+					text += status + "\n"
+				}
+				if text != "" {
+					d.write(text, true)
+				}
+			case d.mode == JSON && g != nil:
+				for _, e := range g.progressEvents() {
+					d.write(encode(e), false)
+				}
+			case d.mode == Bar && (g != nil || status != "" || d.drawn > 0):
+				d.write("", true)
+			}
+		case <-d.quit:
+			d.write("", false)
+			return
+		}
+	}
+}
+
+// current returns the transfer in progress, if any, and the status line
+func (d *Display) current() (*Group, string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.group, d.status
+}
+
+// write replaces the bars on screen with text, followed by the bars of the
+// current transfer and the status line if redraw is set
+func (d *Display) write(text string, redraw bool) {
+	var b strings.Builder
+	if d.drawn > 0 {
+		b.WriteString("\r")
+		b.WriteString(strings.Repeat("\033[A", d.drawn-1))
+		b.WriteString("\033[J")
+		d.drawn = 0
+	}
+	b.WriteString(text)
+
+	if g, status := d.current(); d.mode == Bar && redraw {
+		var lines []string
+		width := terminalWidth()
+		if g != nil {
+			lines = g.bars(width)
+		}
+		if status != "" {
+			lines = append(lines, truncate(status, width-1))
+		}
+		b.WriteString(strings.Join(lines, "\n"))
+		d.drawn = len(lines)
+	}
+	io.WriteString(d.w, b.String())
+}
+
+// terminalWidth returns $COLUMNS, or 80 if that isn't set
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 20 {
+		return n
+	}
+	return 80
+}
+
+// Group is a set of files transferred together, such as the files of a
+// collection upload. Its bars stay on screen until Done.
+type Group struct {
+	d     *Display
+	start time.Time
+	files int64 // Expected, grows as tasks start beyond it
+
+	bytes    atomic.Int64 // Expected total, -1 if unknown
+	sent     atomic.Int64 // Bytes of all tasks, finished or not
+	skipped  atomic.Int64 // Part of sent that was done before, see Task.Skip
+	finished atomic.Int64 // Tasks done
+
+	mu    sync.Mutex
+	tasks []*Task // Active
+	meter meter
+}
+
+// Group starts showing a transfer of files with bytes in total. Pass a
+// negative bytes if the size isn't known. It replaces any earlier Group.
+func (d *Display) Group(files int, bytes int64) *Group {
+	if d == nil {
+		return nil
+	}
+	g := &Group{d: d, start: time.Now(), files: int64(files)}
+	g.bytes.Store(bytes)
+	g.meter.add(g.start, 0)
+	d.mu.Lock()
+	d.group = g
+	d.mu.Unlock()
+	return g
+}
+
+// Done removes the bars of the transfer and prints a summary of it, with
+// verb describing what happened, e.g. "Uploaded"
+func (g *Group) Done(verb string) {
+	if g == nil {
+		return
+	}
+	d := g.d
+	d.mu.Lock()
+	if d.group == g {
+		d.group = nil
+	}
+	d.mu.Unlock()
+
+	if d.mode == None || d.mode == Quiet || d.mode == JSON || g.finished.Load() == 0 {
+		d.print("")
+		return
+	}
+	d.print(g.summary(verb, time.Now()) + "\n")
+}
+
+// Task is the transfer of one file in a Group
+type Task struct {
+	g        *Group
+	name     string
+	total    int64 // -1 if unknown
+	sent     atomic.Int64
+	reported atomic.Int64 // Sent as of the last FileProgress event
+}
+
+// Start adds a file of total bytes, or -1 if unknown, to the transfer
+func (g *Group) Start(name string, total int64) *Task {
+	if g == nil {
+		return nil
+	}
+	t := &Task{g: g, name: name, total: total}
+	g.mu.Lock()
+	g.tasks = append(g.tasks, t)
+	if n := int64(len(g.tasks)) + g.finished.Load(); n > g.files {
+		g.files = n
+	}
+	g.mu.Unlock()
+	t.Event(Event{Type: FileStarted, Size: total})
+	return t
+}
+
+// Add records n more bytes sent. A negative n takes back bytes of an
+// attempt that failed and will be sent again.
+func (t *Task) Add(n int64) {
+	if t == nil {
+		return
+	}
+	t.sent.Add(n)
+	t.g.sent.Add(n)
+}
+
+// Skip records n bytes that an earlier run already transferred. They
+// count toward completion but not toward the transfer rate.
+func (t *Task) Skip(n int64) {
+	if t == nil {
+		return
+	}
+	t.Add(n)
+	t.g.skipped.Add(n)
+}
+
+// Done marks the file as transferred
+func (t *Task) Done() {
+	if t == nil {
+		return
+	}
+	if e, ok := t.progressEvent(); ok {
+		t.g.d.Emit(e)
+	}
+	if t.total < 0 && t.g.bytes.Load() >= 0 {
+		// Now that the size is known, it counts toward the total
+		t.g.bytes.Add(t.sent.Load())
+	}
+	t.g.finished.Add(1)
+	t.g.remove(t)
+}
+
+// Fail marks the file as failed by err. Its bytes no longer count toward
+// the transfer.
+func (t *Task) Fail(err error) {
+	if t == nil {
+		return
+	}
+	t.Event(Event{Type: Error, Error: err.Error()})
+	g := t.g
+	g.sent.Add(-t.sent.Load())
+	if t.total > 0 && g.bytes.Load() >= 0 {
+		g.bytes.Add(-t.total)
+	}
+	g.mu.Lock()
+	g.files--
+	g.mu.Unlock()
+	g.remove(t)
+}
+
+func (g *Group) remove(t *Task) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, task := range g.tasks {
+		if task == t {
+			g.tasks = append(g.tasks[:i], g.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// sample feeds the transfer rate meter
+func (g *Group) sample(now time.Time) {
+	g.mu.Lock()
+	g.meter.add(now, g.sent.Load()-g.skipped.Load())
+	g.mu.Unlock()
+}
+
+// snapshot returns a copy of the active tasks, the transfer rate and the
+// number of files expected
+func (g *Group) snapshot() ([]*Task, float64, int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*Task(nil), g.tasks...), g.meter.rate(), g.files
+}
+
+// single reports whether the transfer is of one file only
+func (g *Group) single() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.files <= 1
+}
+
+// sizes formats sent of total bytes
+func sizes(sent, total int64) string {
+	if total < 0 {
+		return HumanSize(sent)
+	}
+	return HumanSize(sent) + " / " + HumanSize(total)
+}
+
+// amounts formats sent of total bytes, with the percentage if total is known
+func amounts(sent, total int64) string {
+	if total < 0 {
+		return HumanSize(sent)
+	}
+	return fmt.Sprintf("%s (%.1f%%)", sizes(sent, total), percent(sent, total))
+}
+
+func percent(sent, total int64) float64 {
+	if total <= 0 {
+		return 100
+	}
+	return min(float64(sent)/float64(total)*100, 100)
+}
+
+// speed formats the rate and, if the total is known, the time left
+func speed(rate float64, sent, total int64) string {
+	s := HumanSize(int64(rate)) + "/s"
+	if total < 0 {
+		return s
+	}
+	eta := "--"
+	if rate > 0 {
+		eta = FormatDuration(time.Duration(float64(total-sent) / rate * float64(time.Second)))
+	}
+	return s + ", ETA " + eta
+}
+
+// status is the line Plain mode prints periodically
+func (g *Group) status() string {
+	tasks, rate, files := g.snapshot()
+	if files <= 1 && len(tasks) == 1 {
+		t := tasks[0]
+		sent := t.sent.Load()
+		return fmt.Sprintf("  %s: %s, %s", t.name, amounts(sent, t.total), speed(rate, sent, t.total))
+	}
+	sent, total := g.sent.Load(), g.bytes.Load()
+	return fmt.Sprintf("  %s, %d/%d files, %s", amounts(sent, total), g.finished.Load(), files, speed(rate, sent, total))
+}
+
+// bars are the lines Bar mode draws, none longer than width
+func (g *Group) bars(width int) []string {
+	tasks, rate, files := g.snapshot()
+	single := files <= 1
+	shown := tasks[:min(len(tasks), maxBars)]
+
+	// Names and bars share what the numbers leave of the line
+	room := width - 1 - barFixedWidth
+	if single {
+		room -= barSpeedWidth
+	}
+	nameWidth := 0
+	for _, t := range shown {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(t.name))
+	}
+	nameWidth = min(nameWidth, max(room/2, 8))
+	barWidth := min(max(room-nameWidth, minBarWidth), maxBarWidth)
+
+	var lines []string
+	for _, t := range shown {
+		sent := t.sent.Load()
+		pct := "      "
+		if t.total >= 0 {
+			pct = fmt.Sprintf("%5.1f%%", percent(sent, t.total))
+		}
+		line := fmt.Sprintf("  %s %s %s  %s", pad(t.name, nameWidth), bar(sent, t.total, barWidth), pct, sizes(sent, t.total))
+		if single {
+			line += "  " + speed(rate, sent, t.total)
+		}
+		lines = append(lines, line)
+	}
+	if len(tasks) > len(shown) {
+		lines = append(lines, fmt.Sprintf("  ... and %d more", len(tasks)-len(shown)))
+	}
+	if !single {
+		sent, total := g.sent.Load(), g.bytes.Load()
+		lines = append(lines, fmt.Sprintf("  %d/%d files  %s  %s", g.finished.Load(), files, amounts(sent, total), speed(rate, sent, total)))
+	}
+
+	for i, line := range lines {
+		lines[i] = truncate(line, width-1)
+	}
+	return lines
+}
+
+// summary is printed when the transfer is done
+func (g *Group) summary(verb string, now time.Time) string {
+	elapsed := now.Sub(g.start)
+	rate := float64(g.sent.Load()-g.skipped.Load()) / max(elapsed.Seconds(), 0.001)
+	files := ""
+	if !g.single() {
+		files = fmt.Sprintf(" %d files,", g.finished.Load())
+	}
+	return fmt.Sprintf("  %s%s %s in %s (%s/s)", verb, files, HumanSize(g.sent.Load()), FormatDuration(elapsed), HumanSize(int64(rate)))
+}
+
+// bar draws e.g. [=======>            ] with width characters between the
+// brackets
+func bar(sent, total int64, width int) string {
+	if total < 0 {
+		return "[" + strings.Repeat("-", width) + "]"
+	}
+	filled := int(percent(sent, total) / 100 * float64(width))
+	if filled >= width {
+		return "[" + strings.Repeat("=", width) + "]"
+	}
+	return "[" + strings.Repeat("=", filled) + ">" + strings.Repeat(" ", width-filled-1) + "]"
+}
+
+// pad fits name into width runes, cutting from the front since the end of
+// a path tells files apart best
+func pad(name string, width int) string {
+	n := utf8.RuneCountInString(name)
+	if n > width {
+		r := []rune(name)
+		return "..." + string(r[n-width+3:])
+	}
+	return name + strings.Repeat(" ", width-n)
+}
+
+// truncate cuts s to at most width runes
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// meter measures the transfer rate over the last rateWindow
+type meter struct {
+	samples []sample
+}
+
+type sample struct {
+	t time.Time
+	n int64
+}
+
+func (m *meter) add(t time.Time, n int64) {
+	m.samples = append(m.samples, sample{t, n})
+	for len(m.samples) > 2 && t.Sub(m.samples[1].t) >= rateWindow {
+		m.samples = m.samples[1:]
+	}
+}
+
+// rate returns bytes per second, or 0 before there are two samples
+func (m *meter) rate() float64 {
+	if len(m.samples) < 2 {
+		return 0
+	}
+	first, last := m.samples[0], m.samples[len(m.samples)-1]
+	secs := last.t.Sub(first.t).Seconds()
+	if secs <= 0 {
+		return 0
+	}
+	return max(float64(last.n-first.n)/secs, 0)
+}
+
+// FormatDuration formats a duration as e.g. "2h05m", "4m30s" or "12s"
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d / time.Hour)
+	m := int(d % time.Hour / time.Minute)
+	s := int(d % time.Minute / time.Second)
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh%02dm", h, m)
+	case m > 0:
+		return fmt.Sprintf("%dm%02ds", m, s)
+	}
+	return fmt.Sprintf("%ds", s)
+}
@@ -0,0 +1,267 @@
+package progress
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{12 * time.Second, "12s"},
+		{4*time.Minute + 30*time.Second, "4m30s"},
+		{2*time.Hour + 5*time.Minute + 59*time.Second, "2h05m"},
+		{1500 * time.Millisecond, "2s"},
+	}
+	for _, tt := range tests {
+		if got := FormatDuration(tt.d); got != tt.want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, s := range []string{"plain", "bar", "none", "json"} {
+		if m, err := ParseMode(s); err != nil || string(m) != s {
+			t.Errorf("ParseMode(%q) = %q, %v", s, m, err)
+		}
+	}
+	for _, s := range []string{"", "quiet", "fancy"} {
+		if _, err := ParseMode(s); err == nil {
+			t.Errorf("ParseMode(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestMeter(t *testing.T) {
+	var m meter
+	start := time.Now()
+	if m.rate() != 0 {
+		t.Errorf("rate() without samples = %v, want 0", m.rate())
+	}
+	// 1 MB/s for 10s, then 3 MB/s; only the last 5s count
+	for i := 0; i <= 10; i++ {
+		m.add(start.Add(time.Duration(i)*time.Second), int64(i)<<20)
+	}
+	for i := 1; i <= 5; i++ {
+		m.add(start.Add(time.Duration(10+i)*time.Second), int64(10+3*i)<<20)
+	}
+	if got, want := m.rate(), float64(3<<20); got != want {
+		t.Errorf("rate() = %v, want %v", got, want)
+	}
+}
+
+func TestBar(t *testing.T) {
+	tests := []struct {
+		sent, total int64
+		want        string
+	}{
+		{0, 100, "[>         ]"},
+		{50, 100, "[=====>    ]"},
+		{100, 100, "[==========]"},
+		{0, 0, "[==========]"},
+		{5, -1, "[----------]"},
+	}
+	for _, tt := range tests {
+		if got := bar(tt.sent, tt.total, 10); got != tt.want {
+			t.Errorf("bar(%d, %d) = %q, want %q", tt.sent, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	if got := pad("a.txt", 8); got != "a.txt   " {
+		t.Errorf("pad() = %q", got)
+	}
+	if got := pad("dir/sub/file.txt", 10); got != "...ile.txt" {
+		t.Errorf("pad() = %q", got)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	d := New(&bytes.Buffer{}, None)
+	defer d.Stop()
+
+	g := d.Group(3, 300)
+	a := g.Start("a", 100)
+	b := g.Start("b", 100)
+	a.Add(100)
+	a.Done()
+	b.Add(60)
+	b.Add(-20) // Failed attempt rolled back
+	if got := g.status(); got != "  140 B / 300 B (46.7%), 1/3 files, 0 B/s, ETA --" {
+		t.Errorf("status() = %q", got)
+	}
+
+	b.Fail(errors.New("failed"))
+	c := g.Start("c", 100)
+	c.Skip(50)
+	if got, want := g.sent.Load(), int64(150); got != want {
+		t.Errorf("sent = %d, want %d", got, want)
+	}
+	if got, want := g.bytes.Load(), int64(200); got != want {
+		t.Errorf("bytes = %d, want %d", got, want)
+	}
+
+	for _, width := range []int{40, 80, 200} {
+		for _, line := range g.bars(width) {
+			if utf8.RuneCountInString(line) >= width {
+				t.Errorf("bars(%d) line too long: %q", width, line)
+			}
+		}
+	}
+}
+
+func TestGroupSingle(t *testing.T) {
+	d := New(&bytes.Buffer{}, None)
+	defer d.Stop()
+
+	g := d.Group(1, -1)
+	s := g.Start("stdin", -1)
+	s.Add(2048)
+	if got := g.status(); got != "  stdin: 2.0 KB, 0 B/s" {
+		t.Errorf("status() = %q", got)
+	}
+	lines := g.bars(80)
+	if len(lines) != 1 || !strings.Contains(lines[0], "2.0 KB") {
+		t.Errorf("bars() = %q, want one line for the file", lines)
+	}
+	s.Done()
+	if !strings.HasPrefix(g.summary("Uploaded", time.Now()), "  Uploaded 2.0 KB in ") {
+		t.Errorf("summary() = %q", g.summary("Uploaded", time.Now()))
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, Plain)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.Printf("message\n")
+		}()
+	}
+	wg.Wait()
+
+	g := d.Group(1, 10)
+	task := g.Start("a", 10)
+	task.Add(10)
+	task.Done()
+	g.Done("Uploaded")
+	d.Stop()
+	d.Printf("after stop\n")
+
+	out := buf.String()
+	if n := strings.Count(out, "message\n"); n != 10 {
+		t.Errorf("got %d messages, want 10:\n%s", n, out)
+	}
+	if !strings.Contains(out, "  Uploaded 10 B in ") || !strings.HasSuffix(out, "after stop\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestDisplayQuiet(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, Quiet)
+	d.Printf("info\n")
+	d.Warnf("warning\n")
+	g := d.Group(1, 1)
+	g.Start("a", 1).Done()
+	g.Done("Uploaded")
+	d.Stop()
+
+	if got := buf.String(); got != "warning\n" {
+		t.Errorf("output = %q, want only the warning", got)
+	}
+}
+
+func TestNilDisplay(t *testing.T) {
+	var d *Display
+	d.Printf("ignored")
+	g := d.Group(1, 1)
+	task := g.Start("a", 1)
+	task.Add(1)
+	task.Done()
+	g.Done("Uploaded")
+	d.Stop()
+}
+
+func TestDisplayStatus(t *testing.T) {
+	tests := []struct {
+		mode Mode
+		want string
+	}{
+		// Only the first of a run of status lines is printed
+		{None, "waiting 2s\nafter\n"},
+		{Quiet, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		d := New(&buf, tt.mode)
+		d.SetStatus("waiting 2s")
+		d.SetStatus("waiting 1s")
+		d.SetStatus("")
+		d.Printf("after\n")
+		d.Stop()
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s: output = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+
+	// Bar mode draws the line in place and clears it again
+	var buf bytes.Buffer
+	d := New(&buf, Bar)
+	d.SetStatus("waiting 2s")
+	d.Printf("message\n")
+	d.SetStatus("")
+	d.Printf("after\n")
+	d.Stop()
+	got := buf.String()
+	if !strings.Contains(got, "message\nwaiting 2s") || !strings.HasSuffix(got, "\r\033[Jafter\n") {
+		t.Errorf("bar output = %q, want the status below the message and cleared before the next", got)
+	}
+}
+
+func TestGroupConcurrent(t *testing.T) {
+	d := New(&bytes.Buffer{}, None)
+	defer d.Stop()
+	g := d.Group(1, -1)
+
+	// Run with -race: status lines are drawn while workers start and fail
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				task := g.Start("a", 10)
+				task.Add(5)
+				task.Fail(errors.New("failed"))
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			g.status()
+			g.bars(80)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package progress
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventType is the type of an Event
+type EventType string
+
+const (
+	FileStarted     EventType = "file_started"     // File, Size (-1 if unknown)
+	FileProgress    EventType = "file_progress"    // File, Bytes sent so far, Size
+	PartCompleted   EventType = "part_completed"   // File, Part, Bytes of the part
+	Retry           EventType = "retry"            // File, Part, Attempt, WaitSeconds, Error
+	FileConfirmed   EventType = "file_confirmed"   // File, URL
+	CollectionReady EventType = "collection_ready" // Collection, URL
+	Error           EventType = "error"            // File if about one file, Error
+	Message         EventType = "message"          // Message
+	Warning         EventType = "warning"          // Message
+)
+
+// jsonInterval is how often JSON mode reports the progress of each file
+const jsonInterval = 500 * time.Millisecond
+
+// Event is one line of JSON mode output. Which fields are set depends on
+// the Type.
+type Event struct {
+	Type        EventType `json:"type"`
+	Time        time.Time `json:"time"`
+	File        string    `json:"file,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	Bytes       int64     `json:"bytes,omitempty"`
+	Part        int       `json:"part,omitempty"`
+	Attempt     int       `json:"attempt,omitempty"`
+	WaitSeconds float64   `json:"wait_seconds,omitempty"`
+	Collection  string    `json:"collection,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Emit writes e as a line of JSON if the Display is in JSON mode. Other
+// modes show the same information their own way and ignore events.
+func (d *Display) Emit(e Event) {
+	if d == nil || d.mode != JSON {
+		return
+	}
+	d.print(encode(e))
+}
+
+// encode formats e as a line of JSON, stamping it with the current time
+// unless it has one
+func encode(e Event) string {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, _ := json.Marshal(e)
+	return string(line) + "\n"
+}
+
+// Event emits e for the task's file
+func (t *Task) Event(e Event) {
+	if t == nil {
+		return
+	}
+	e.File = t.name
+	t.g.d.Emit(e)
+}
+
+// progressEvents returns FileProgress events for the tasks of g that sent
+// bytes since they were last reported
+func (g *Group) progressEvents() []Event {
+	tasks, _, _ := g.snapshot()
+	var events []Event
+	for _, t := range tasks {
+		if e, ok := t.progressEvent(); ok {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (t *Task) progressEvent() (Event, bool) {
+	sent := t.sent.Load()
+	if t.reported.Swap(sent) == sent {
+		return Event{}, false
+	}
+	return Event{Type: FileProgress, File: t.name, Bytes: sent, Size: t.total}, true
+}
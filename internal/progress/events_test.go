@@ -0,0 +1,69 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDisplayJSON(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, JSON)
+	d.Printf("Uploading 2 files...\n")
+	g := d.Group(2, 30)
+	a := g.Start("a", 10)
+	a.Add(10)
+	a.Event(Event{Type: PartCompleted, Part: 1, Bytes: 10})
+	a.Done()
+	b := g.Start("b", 20)
+	b.Fail(errors.New("upload failed (HTTP 400)"))
+	d.Emit(Event{Type: CollectionReady, Collection: "C1", URL: "https://storage.to/c/C1"})
+	g.Done("Uploaded")
+	d.Warnf("Warning: 1 files failed to upload\n")
+	d.Stop()
+
+	var got []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("event %q has no time", scanner.Text())
+		}
+		got = append(got, e)
+	}
+
+	want := []Event{
+		{Type: Message, Message: "Uploading 2 files..."},
+		{Type: FileStarted, File: "a", Size: 10},
+		{Type: PartCompleted, File: "a", Part: 1, Bytes: 10},
+		{Type: FileProgress, File: "a", Bytes: 10, Size: 10},
+		{Type: FileStarted, File: "b", Size: 20},
+		{Type: Error, File: "b", Error: "upload failed (HTTP 400)"},
+		{Type: CollectionReady, Collection: "C1", URL: "https://storage.to/c/C1"},
+		{Type: Warning, Message: "Warning: 1 files failed to upload"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range want {
+		got[i].Time = want[i].Time
+		if got[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEmitOtherModes(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, None)
+	d.Emit(Event{Type: CollectionReady, Collection: "C1"})
+	d.Stop()
+	if buf.Len() != 0 {
+		t.Errorf("Emit wrote %q outside JSON mode", buf.String())
+	}
+}
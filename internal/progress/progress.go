@@ -0,0 +1,39 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+)
+
+// Reader wraps a reader to track progress
+type Reader struct {
+	Reader     io.Reader
+	Total      int64
+	Done       int64
+	OnProgress func(done, total int64)
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.Done += int64(n)
+		if r.OnProgress != nil {
+			r.OnProgress(r.Done, r.Total)
+		}
+	}
+	return n, err
+}
+
+// HumanSize formats a byte count for display, e.g. "1.5 MB"
+func HumanSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
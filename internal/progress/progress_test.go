@@ -0,0 +1,45 @@
+package progress
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0 B"},
+		{100, "100 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{1048576, "1.0 MB"},
+		{1073741824, "1.0 GB"},
+		{1099511627776, "1.0 TB"},
+	}
+
+	for _, tt := range tests {
+		got := HumanSize(tt.bytes)
+		if got != tt.want {
+			t.Errorf("HumanSize(%d) = %q, want %q", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	var last int64
+	r := &Reader{
+		Reader:     strings.NewReader("hello world"),
+		Total:      11,
+		OnProgress: func(done, _ int64) { last = done },
+	}
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if last != 11 || r.Done != 11 {
+		t.Errorf("progress = %d (Done %d), want 11", last, r.Done)
+	}
+}
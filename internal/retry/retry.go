@@ -0,0 +1,127 @@
+// Package retry runs operations that can fail transiently, waiting with
+// exponential backoff and jitter between attempts.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Defaults used by the CLI unless overridden with --retries and
+// --retry-max-wait
+const (
+	DefaultRetries   = 3
+	DefaultBaseDelay = time.Second
+	DefaultMaxWait   = 30 * time.Second
+)
+
+// Default is the policy used when no other is configured
+var Default = Policy{
+	Attempts:  DefaultRetries + 1,
+	BaseDelay: DefaultBaseDelay,
+	MaxWait:   DefaultMaxWait,
+}
+
+// Policy decides how often a failed operation is tried again and how long
+// to wait in between. The zero value tries once.
+type Policy struct {
+	// Attempts is the total number of tries, including the first
+	Attempts int
+	// BaseDelay is the wait before the first retry. It doubles with every
+	// further retry.
+	BaseDelay time.Duration
+	// MaxWait caps a single wait. An error asking for a longer wait, e.g.
+	// through Retry-After, is not retried.
+	MaxWait time.Duration
+	// OnRetry, if set, is called before waiting to try again
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// Do calls fn until it succeeds, returns a permanent error or the attempts
+// are used up, and returns its last error. Errors are retried unless marked
+// with Permanent or the context is done.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if perm, ok := err.(*permanentError); ok {
+			return perm.err
+		}
+		if IsPermanent(err) || ctx.Err() != nil || attempt >= p.Attempts {
+			return err
+		}
+
+		wait := p.Backoff(attempt)
+		if after := retryAfter(err); after > 0 {
+			if p.MaxWait > 0 && after > p.MaxWait {
+				return err
+			}
+			wait = after
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns how long to wait after the given failed attempt (starting
+// at 1): BaseDelay doubled per attempt, capped at MaxWait, with the upper
+// half randomized so concurrent clients don't retry in lockstep
+func (p Policy) Backoff(attempt int) time.Duration {
+	wait := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxWait <= 0 || wait < p.MaxWait); i++ {
+		wait *= 2
+	}
+	if p.MaxWait > 0 && wait > p.MaxWait {
+		wait = p.MaxWait
+	}
+	if half := wait / 2; half > 0 {
+		wait = half + rand.N(half+1)
+	}
+	return wait
+}
+
+// permanentError marks an error that retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err so that Do returns it without retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked with
+// Permanent
+func IsPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+// retryAfter returns the wait an error asks for, e.g. from a Retry-After
+// header, if it implements RetryAfter() time.Duration
+func retryAfter(err error) time.Duration {
+	var e interface{ RetryAfter() time.Duration }
+	if errors.As(err, &e) {
+		return e.RetryAfter()
+	}
+	return 0
+}
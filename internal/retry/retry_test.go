@@ -0,0 +1,77 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type afterError time.Duration
+
+func (e afterError) Error() string             { return "slow down" }
+func (e afterError) RetryAfter() time.Duration { return time.Duration(e) }
+
+func TestDo(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	errBad := errors.New("bad request")
+	p := Policy{Attempts: 3, BaseDelay: time.Millisecond, MaxWait: 10 * time.Millisecond}
+
+	tests := []struct {
+		name  string
+		errs  []error // Returned by successive calls, then nil
+		calls int
+		want  error
+	}{
+		{"success", nil, 1, nil},
+		{"recovers", []error{errFlaky, errFlaky}, 3, nil},
+		{"gives up", []error{errFlaky, errFlaky, errFlaky, errFlaky}, 3, errFlaky},
+		{"permanent", []error{Permanent(errBad)}, 1, errBad},
+		{"wrapped permanent", []error{fmt.Errorf("part 1: %w", Permanent(errBad))}, 1, errBad},
+		{"retry after", []error{afterError(2 * time.Millisecond)}, 2, nil},
+		{"retry after too long", []error{afterError(time.Hour)}, 1, afterError(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		err := p.Do(context.Background(), func() error {
+			calls++
+			if calls <= len(tt.errs) {
+				return tt.errs[calls-1]
+			}
+			return nil
+		})
+		if calls != tt.calls {
+			t.Errorf("%s: %d calls, want %d", tt.name, calls, tt.calls)
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := p.Do(ctx, func() error {
+		calls++
+		return errFlaky
+	})
+	if calls != 1 || err != errFlaky {
+		t.Errorf("cancelled: %d calls, error %v; want 1 call, %v", calls, err, errFlaky)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxWait: 5 * time.Second}
+
+	for i, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		attempt := i + 1
+		for n := 0; n < 20; n++ {
+			got := p.Backoff(attempt)
+			if got < max/2 || got > max {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", attempt, got, max/2, max)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package throttle limits the bandwidth of readers with a token bucket that
+// can be shared by any number of concurrent transfers.
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chunkSize bounds a single read so no reader waits long for its tokens
+// while others are starved
+const chunkSize = 32 << 10
+
+// Limiter hands out bytes at a fixed rate. A nil Limiter doesn't limit.
+type Limiter struct {
+	rate  float64 // Bytes per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter for bytesPerSecond, or nil for 0 (unlimited)
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	return &Limiter{
+		rate:   rate,
+		burst:  max(rate, chunkSize),
+		tokens: max(rate, chunkSize),
+		last:   time.Now(),
+	}
+}
+
+// WaitN blocks until n bytes may be sent or ctx is done
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	// Take the tokens now, going into debt if needed, so that concurrent
+	// callers queue up behind each other instead of racing for refills
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Reader returns r limited by l. It returns r itself if l is nil.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx: ctx, limiter: l, r: r}
+}
+
+type reader struct {
+	ctx     context.Context
+	limiter *Limiter
+	r       io.Reader
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// ParseRate parses a rate such as "5MB/s", "500K" or "1.5m" into bytes per
+// second. Units are binary (K = 1024) like progress.HumanSize; the "B" and
+// "/s" suffixes are optional and a bare number is bytes per second.
+func ParseRate(s string) (int64, error) {
+	str := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S")
+	rate, ok := parseBytes(str)
+	if !ok {
+		return 0, fmt.Errorf("invalid rate %q - use e.g. 500KB/s or 5MB/s", s)
+	}
+	return rate, nil
+}
+
+// ParseSize parses a size such as "64MB", "8m" or "1GiB" into bytes, with
+// the same units as ParseRate
+func ParseSize(s string) (int64, error) {
+	size, ok := parseBytes(strings.ToUpper(strings.TrimSpace(s)))
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q - use e.g. 16MB or 1GB", s)
+	}
+	return size, nil
+}
+
+// parseBytes parses an upper case number of bytes with an optional K, M, G
+// or T unit and B or IB suffix. It must be at least 1.
+func parseBytes(str string) (int64, bool) {
+	str = strings.TrimSuffix(str, "IB")
+	str = strings.TrimSuffix(str, "B")
+
+	mult := 1.0
+	if n := len(str); n > 0 {
+		if i := strings.IndexByte("KMGT", str[n-1]); i >= 0 {
+			str = strings.TrimSpace(str[:n-1])
+			for ; i >= 0; i-- {
+				mult *= 1024
+			}
+		}
+	}
+
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+	n := int64(value * mult)
+	return n, n >= 1
+}
@@ -0,0 +1,96 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"5MB/s", 5 << 20},
+		{"500K", 500 << 10},
+		{"500kb/s", 500 << 10},
+		{"1.5m", 3 << 19},
+		{"2MiB/s", 2 << 20},
+		{"1G", 1 << 30},
+		{"4096", 4096},
+		{"100B/s", 100},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "fast", "MB/s", "-1M", "0", "5X/s"} {
+		if _, err := ParseRate(bad); err == nil {
+			t.Errorf("ParseRate(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"64MB", 64 << 20},
+		{"8m", 8 << 20},
+		{"1GiB", 1 << 30},
+		{" 16 MB ", 16 << 20},
+		{"1024", 1024},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "big", "5MB/s", "0", "-8M"} {
+		if _, err := ParseSize(bad); err == nil {
+			t.Errorf("ParseSize(%q) should fail", bad)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if NewLimiter(0) != nil {
+		t.Fatal("NewLimiter(0) should not limit")
+	}
+
+	// Two readers share 1 MB/s: after the 1 MB burst, another 512 KB
+	// takes about half a second no matter how it is split
+	l := NewLimiter(1 << 20)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			io.Copy(io.Discard, l.Reader(context.Background(), bytes.NewReader(make([]byte, 768<<10))))
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("1.5 MB at 1 MB/s took %v, want about 0.5s", elapsed)
+	}
+
+	// Waiting stops with the context
+	l = NewLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.WaitN(ctx, chunkSize)
+	if err := l.WaitN(ctx, chunkSize); err != context.Canceled {
+		t.Errorf("WaitN() with cancelled context = %v, want context.Canceled", err)
+	}
+}
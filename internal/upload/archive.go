@@ -0,0 +1,138 @@
+package upload
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+// ArchiveFormats lists the formats supported by UploadArchive
+var ArchiveFormats = []string{"tar.gz", "zip"}
+
+// UploadArchive packs files into a tar.gz or zip archive on the fly and
+// uploads it as a single file. Each File.Name becomes the path inside the
+// archive. The archive is never written to disk.
+func (u *Uploader) UploadArchive(ctx context.Context, files []File, format, name, collectionID string) (*api.FileInfo, error) {
+	if !isArchiveFormat(format) {
+		return nil, fmt.Errorf("unsupported archive format %q (use tar.gz or zip)", format)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeArchive(ctx, pw, files, format))
+	}()
+
+	fileInfo, err := u.UploadStream(ctx, pr, name, collectionID)
+	// Unblock the archive writer if the upload stopped reading early
+	pr.CloseWithError(fmt.Errorf("upload stopped"))
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo, nil
+}
+
+func isArchiveFormat(format string) bool {
+	for _, f := range ArchiveFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeArchive writes files to w as an archive in the given format
+func writeArchive(ctx context.Context, w io.Writer, files []File, format string) error {
+	switch format {
+	case "tar.gz":
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+		for _, f := range files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := addTarEntry(tw, f); err != nil {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
+
+	case "zip":
+		zw := zip.NewWriter(w)
+		for _, f := range files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := addZipEntry(zw, f); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	}
+	return fmt.Errorf("unsupported archive format %q", format)
+}
+
+func addTarEntry(tw *tar.Writer, f File) error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %w", f.Path, err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat %s: %w", f.Path, err)
+	}
+
+	hdr, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return fmt.Errorf("cannot archive %s: %w", f.Path, err)
+	}
+	hdr.Name = f.Name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	// Copy exactly the size recorded in the header, in case the file grows
+	if _, err := io.CopyN(tw, file, stat.Size()); err != nil {
+		return fmt.Errorf("cannot read %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+func addZipEntry(zw *zip.Writer, f File) error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %w", f.Path, err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat %s: %w", f.Path, err)
+	}
+
+	hdr, err := zip.FileInfoHeader(stat)
+	if err != nil {
+		return fmt.Errorf("cannot archive %s: %w", f.Path, err)
+	}
+	hdr.Name = f.Name
+	hdr.Method = zip.Deflate
+
+	entry, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(entry, file); err != nil {
+		return fmt.Errorf("cannot read %s: %w", f.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package upload
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeArchiveFixture(t *testing.T) []File {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	var files []File
+	for name, content := range map[string]string{
+		"a.txt":     "first file",
+		"dir/b.txt": "second file",
+	} {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		files = append(files, File{Path: path, Name: name})
+	}
+	return files
+}
+
+func TestWriteArchiveTarGz(t *testing.T) {
+	files := writeArchiveFixture(t)
+
+	var buf bytes.Buffer
+	if err := writeArchive(context.Background(), &buf, files, "tar.gz"); err != nil {
+		t.Fatalf("writeArchive() error = %v", err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	tr := tar.NewReader(gz)
+	got := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar.Next() error = %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(data)
+	}
+
+	if got["a.txt"] != "first file" || got["dir/b.txt"] != "second file" {
+		t.Errorf("tar.gz contents = %v", got)
+	}
+}
+
+func TestWriteArchiveZip(t *testing.T) {
+	files := writeArchiveFixture(t)
+
+	var buf bytes.Buffer
+	if err := writeArchive(context.Background(), &buf, files, "zip"); err != nil {
+		t.Fatalf("writeArchive() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("zip Open(%s) error = %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(data)
+	}
+
+	if got["a.txt"] != "first file" || got["dir/b.txt"] != "second file" {
+		t.Errorf("zip contents = %v", got)
+	}
+}
@@ -0,0 +1,77 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+// Checksum algorithms for Options.Checksum
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumCRC32C = "crc32c"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CheckChecksum returns an error if alg is not a supported algorithm
+func CheckChecksum(alg string) error {
+	switch alg {
+	case "", ChecksumSHA256, ChecksumCRC32C:
+		return nil
+	}
+	return fmt.Errorf("unknown checksum %q - use %s or %s", alg, ChecksumSHA256, ChecksumCRC32C)
+}
+
+// ChecksumName returns the display name of alg, e.g. "SHA-256"
+func ChecksumName(alg string) string {
+	switch alg {
+	case ChecksumSHA256:
+		return "SHA-256"
+	case ChecksumCRC32C:
+		return "CRC-32C"
+	}
+	return alg
+}
+
+// newHash returns a hash for Options.Checksum, or nil if checksums are off
+func (u *Uploader) newHash() hash.Hash {
+	switch u.opts.Checksum {
+	case ChecksumSHA256:
+		return sha256.New()
+	case ChecksumCRC32C:
+		return crc32.New(crc32cTable)
+	}
+	return nil
+}
+
+// digest returns the Digest to confirm an upload with, or a zero Digest
+// if sum is nil
+func (u *Uploader) digest(sum hash.Hash) api.Digest {
+	if sum == nil {
+		return api.Digest{}
+	}
+	return api.Digest{
+		ChecksumAlgorithm: u.opts.Checksum,
+		Checksum:          hex.EncodeToString(sum.Sum(nil)),
+	}
+}
+
+// checksumHeader returns the header and value that make storage reject a
+// PUT whose body doesn't match sum
+func (u *Uploader) checksumHeader(sum hash.Hash) (string, string) {
+	return "x-amz-checksum-" + u.opts.Checksum, base64.StdEncoding.EncodeToString(sum.Sum(nil))
+}
+
+// withDigest sets d on info unless the server already reported one
+func withDigest(info *api.FileInfo, d api.Digest) *api.FileInfo {
+	if info != nil && info.Checksum == "" {
+		info.Digest = d
+	}
+	return info
+}
@@ -0,0 +1,116 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+// contentHash returns the hex SHA-256 of r, which identifies content for
+// deduplication, along with the Digest for Options.Checksum computed in
+// the same pass
+func (u *Uploader) contentHash(r io.Reader) (string, api.Digest, error) {
+	h := sha256.New()
+	var sum hash.Hash
+	w := io.Writer(h)
+	if u.opts.Checksum != "" && u.opts.Checksum != ChecksumSHA256 {
+		sum = u.newHash()
+		w = io.MultiWriter(h, sum)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return "", api.Digest{}, err
+	}
+
+	hexHash := hex.EncodeToString(h.Sum(nil))
+	if sum == nil && u.opts.Checksum != "" {
+		return hexHash, api.Digest{ChecksumAlgorithm: ChecksumSHA256, Checksum: hexHash}, nil
+	}
+	return hexHash, u.digest(sum), nil
+}
+
+// findExisting asks the server which of hashes it already has content for
+func (u *Uploader) findExisting(ctx context.Context, hashes []string) (map[string]api.ExistingUpload, error) {
+	existing := make(map[string]api.ExistingUpload)
+	for start := 0; start < len(hashes); start += u.opts.BatchSize {
+		end := min(start+u.opts.BatchSize, len(hashes))
+		resp, err := u.client.UploadExists(ctx, &api.UploadExistsRequest{Hashes: hashes[start:end]})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check for existing uploads: %w", err)
+		}
+		for h, e := range resp.Existing {
+			existing[h] = e
+		}
+	}
+	return existing, nil
+}
+
+// dedup links files of a batch to content that is already stored, or that
+// an earlier file of the same batch uploads, and returns the files that
+// still need uploading. Files must have been hashed.
+func (u *Uploader) dedup(ctx context.Context, files []*fileMetadata) ([]*fileMetadata, error) {
+	first := make(map[string]*fileMetadata)
+	var unique []*fileMetadata
+	var hashes []string
+	for _, f := range files {
+		if orig, ok := first[f.hash]; ok && orig.size == f.size {
+			f.sameAs = orig
+			continue
+		}
+		first[f.hash] = f
+		unique = append(unique, f)
+		hashes = append(hashes, f.hash)
+	}
+
+	existing, err := u.findExisting(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*fileMetadata
+	for _, f := range unique {
+		if e, ok := existing[f.hash]; ok && e.R2Key != "" && e.Size == f.size {
+			f.r2Key = e.R2Key
+			continue
+		}
+		pending = append(pending, f)
+	}
+
+	if skipped := len(files) - len(pending); skipped > 0 {
+		u.opts.Progress.Printf("Skipping %d of %d files, their content is already uploaded\n", skipped, len(files))
+	}
+	return pending, nil
+}
+
+// linkExisting confirms a single file with stored content identical to r,
+// if the server has any. It returns nil if the content is new.
+func (u *Uploader) linkExisting(ctx context.Context, r io.ReadSeeker, filename, contentType string, size int64, collectionID string) (*api.FileInfo, error) {
+	contentHash, digest, err := u.contentHash(r)
+	r.Seek(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file: %w", err)
+	}
+
+	existing, err := u.findExisting(ctx, []string{contentHash})
+	if err != nil {
+		return nil, err
+	}
+	e, ok := existing[contentHash]
+	if !ok || e.R2Key == "" || e.Size != size {
+		return nil, nil
+	}
+
+	u.opts.Progress.Printf("%s is already uploaded, linking to it\n", filename)
+	return u.confirmFile(ctx, &api.ConfirmUploadRequest{
+		Filename:     filename,
+		Size:         size,
+		ContentType:  contentType,
+		R2Key:        e.R2Key,
+		CollectionID: collectionID,
+		Digest:       digest,
+	})
+}
@@ -0,0 +1,62 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+func TestContentHash(t *testing.T) {
+	u := NewUploader(nil, Options{Dedup: true, Checksum: ChecksumCRC32C})
+	hash, digest, err := u.contentHash(strings.NewReader("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("hash = %s, want SHA-256 of abc", hash)
+	}
+	if digest.ChecksumAlgorithm != ChecksumCRC32C || digest.Checksum != "364b3fb7" {
+		t.Errorf("digest = %+v, want CRC-32C of abc", digest)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.UploadExistsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Hashes) != 2 {
+			t.Errorf("server asked about %d hashes, want 2 unique ones", len(req.Hashes))
+		}
+		json.NewEncoder(w).Encode(api.UploadExistsResponse{
+			Success: true,
+			Existing: map[string]api.ExistingUpload{
+				"bbbb": {R2Key: "k/old/b.txt", Size: 20},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	a := &fileMetadata{filename: "a.txt", hash: "aaaa", size: 10}
+	aCopy := &fileMetadata{filename: "copy/a.txt", hash: "aaaa", size: 10}
+	b := &fileMetadata{filename: "b.txt", hash: "bbbb", size: 20}
+
+	u := NewUploader(api.NewClient(srv.URL, ""), Options{Dedup: true})
+	pending, err := u.dedup(context.Background(), []*fileMetadata{a, aCopy, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != a {
+		t.Errorf("pending = %v, want only a.txt", pending)
+	}
+	if aCopy.sameAs != a {
+		t.Error("copy/a.txt should reuse the upload of a.txt")
+	}
+	if b.r2Key != "k/old/b.txt" {
+		t.Errorf("b.txt r2Key = %q, want the existing content", b.r2Key)
+	}
+}
@@ -0,0 +1,189 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/config"
+)
+
+const (
+	journalDirName  = "uploads"
+	fingerprintSize = 1 << 20 // Bytes hashed to fingerprint a file
+)
+
+// journal records the state of a multipart upload on disk so that it can be
+// resumed after the process exits (crash, sleep, Ctrl+C)
+type journal struct {
+	UploadID     string     `json:"upload_id"`
+	R2Key        string     `json:"r2_key"`
+	Path         string     `json:"path"`
+	Filename     string     `json:"filename"`
+	ContentType  string     `json:"content_type"`
+	Size         int64      `json:"size"`
+	ModTime      time.Time  `json:"mod_time"`
+	Hash         string     `json:"hash,omitempty"` // SHA-256 of the first MiB
+	PartSize     int64      `json:"part_size"`
+	TotalParts   int        `json:"total_parts"`
+	CollectionID string     `json:"collection_id,omitempty"`
+	Parts        []api.Part `json:"parts"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	file string // Location of the journal on disk
+	mu   sync.Mutex
+}
+
+// journalPath returns where the journal for a local file is stored
+func journalPath(absPath string) (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(configDir, journalDirName, hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// newJournal creates a journal for a freshly initialized multipart upload
+func newJournal(absPath string, file *os.File, stat os.FileInfo, filename, contentType, collectionID string, initResp *api.InitUploadResponse) (*journal, error) {
+	path, err := journalPath(absPath)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := fingerprint(file)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journal{
+		UploadID:     initResp.UploadID,
+		R2Key:        initResp.R2Key,
+		Path:         absPath,
+		Filename:     filename,
+		ContentType:  contentType,
+		Size:         stat.Size(),
+		ModTime:      stat.ModTime(),
+		Hash:         hash,
+		PartSize:     initResp.PartSize,
+		TotalParts:   initResp.TotalParts,
+		CollectionID: collectionID,
+		CreatedAt:    time.Now().UTC(),
+		file:         path,
+	}
+	if err := j.save(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// loadJournal returns the journal for a local file, or nil if there is none
+// or the file changed since the journal was written. Stale journals are removed.
+func loadJournal(absPath string, file *os.File, stat os.FileInfo) (*journal, error) {
+	path, err := journalPath(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journal{file: path}
+	if err := json.Unmarshal(data, j); err != nil {
+		os.Remove(path)
+		return nil, nil
+	}
+
+	if j.Path != absPath || j.Size != stat.Size() || !j.ModTime.Equal(stat.ModTime()) {
+		os.Remove(path)
+		return nil, nil
+	}
+	hash, err := fingerprint(file)
+	if err != nil {
+		return nil, err
+	}
+	if j.Hash != "" && j.Hash != hash {
+		os.Remove(path)
+		return nil, nil
+	}
+
+	return j, nil
+}
+
+// initResponse rebuilds the init response for resuming the upload. Presigned
+// URLs are not persisted since they expire; they are fetched again as needed.
+func (j *journal) initResponse() *api.InitUploadResponse {
+	return &api.InitUploadResponse{
+		Success:     true,
+		Type:        "multipart",
+		UploadID:    j.UploadID,
+		R2Key:       j.R2Key,
+		PartSize:    j.PartSize,
+		TotalParts:  j.TotalParts,
+		InitialURLs: make(map[string]string),
+	}
+}
+
+// completedParts returns a copy of the parts uploaded so far
+func (j *journal) completedParts() []api.Part {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]api.Part(nil), j.Parts...)
+}
+
+// addPart records a completed part and persists the journal
+func (j *journal) addPart(part api.Part) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Parts = append(j.Parts, part)
+	return j.saveLocked()
+}
+
+func (j *journal) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.saveLocked()
+}
+
+func (j *journal) saveLocked() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to encode resume journal: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(j.file), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename so a crash never leaves a torn journal
+	tmp := j.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.file)
+}
+
+// remove deletes the journal once the upload is complete or abandoned
+func (j *journal) remove() {
+	os.Remove(j.file)
+}
+
+// fingerprint hashes the start of a file to detect content changes that
+// keep the same size and modification time
+func fingerprint(file *os.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, fingerprintSize)); err != nil {
+		return "", fmt.Errorf("cannot read file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,212 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/storageto/cli/internal/api"
+)
+
+func TestJournalRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, ".config"))
+
+	path := filepath.Join(tmpDir, "backup.bin")
+	if err := os.WriteFile(path, []byte("some backup data"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+	stat, _ := file.Stat()
+
+	initResp := &api.InitUploadResponse{
+		UploadID:   "upload-1",
+		R2Key:      "key-1",
+		PartSize:   8,
+		TotalParts: 2,
+	}
+	j, err := newJournal(path, file, stat, "backup.bin", "application/octet-stream", "", initResp)
+	if err != nil {
+		t.Fatalf("newJournal() error = %v", err)
+	}
+	if err := j.addPart(api.Part{PartNumber: 1, ETag: "etag-1"}); err != nil {
+		t.Fatalf("addPart() error = %v", err)
+	}
+
+	loaded, err := loadJournal(path, file, stat)
+	if err != nil {
+		t.Fatalf("loadJournal() error = %v", err)
+	}
+	if loaded == nil {
+		t.Fatal("loadJournal() returned nil for unchanged file")
+	}
+	if loaded.UploadID != "upload-1" || loaded.R2Key != "key-1" {
+		t.Errorf("loaded journal = %+v, want upload-1/key-1", loaded)
+	}
+	if parts := loaded.completedParts(); len(parts) != 1 || parts[0].ETag != "etag-1" {
+		t.Errorf("completedParts() = %v, want one part with etag-1", parts)
+	}
+
+	resp := loaded.initResponse()
+	if resp.InitialURLs == nil || len(resp.InitialURLs) != 0 {
+		t.Errorf("initResponse() should have an empty URL map, got %v", resp.InitialURLs)
+	}
+
+	loaded.remove()
+	if again, _ := loadJournal(path, file, stat); again != nil {
+		t.Error("journal still present after remove()")
+	}
+}
+
+func TestJournalDiscardedWhenFileChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, ".config"))
+
+	path := filepath.Join(tmpDir, "backup.bin")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	file, _ := os.Open(path)
+	stat, _ := file.Stat()
+	if _, err := newJournal(path, file, stat, "backup.bin", "", "", &api.InitUploadResponse{UploadID: "u"}); err != nil {
+		t.Fatalf("newJournal() error = %v", err)
+	}
+	file.Close()
+
+	// Same size, different content and mtime
+	if err := os.WriteFile(path, []byte("modified"), 0644); err != nil {
+		t.Fatalf("failed to rewrite test file: %v", err)
+	}
+	os.Chtimes(path, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+
+	file, _ = os.Open(path)
+	defer file.Close()
+	stat, _ = file.Stat()
+	j, err := loadJournal(path, file, stat)
+	if err != nil {
+		t.Fatalf("loadJournal() error = %v", err)
+	}
+	if j != nil {
+		t.Error("loadJournal() should ignore a journal for a changed file")
+	}
+}
+
+// interruptedUpload starts a resumable upload of a 4-part file to s and
+// cancels it when part 3 is sent, so parts 1 and 2 are in the journal
+func interruptedUpload(t *testing.T, s *fakeServer, resume bool) (path string, data []byte) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, ".config"))
+
+	path = filepath.Join(tmpDir, "backup.bin")
+	data = []byte("0123456789abcdefghijklmnopqrstuvwxyzABCD")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.onPart = func(number int) int {
+		if number == 3 {
+			cancel()
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+	u := testUploader(s, Options{Resume: resume, ConcurrentParts: 1})
+	if _, err := u.UploadFile(ctx, path, ""); err == nil {
+		t.Fatal("UploadFile() succeeded, want it cancelled")
+	}
+	s.onPart = nil
+	return path, data
+}
+
+func TestUploadFileResume(t *testing.T) {
+	s := newFakeServer(t, 10)
+	path, data := interruptedUpload(t, s, true)
+	if len(s.aborted) != 0 {
+		t.Errorf("aborted uploads = %v, want the upload kept for --resume", s.aborted)
+	}
+	journalFile, _ := journalPath(path)
+	if _, err := os.Stat(journalFile); err != nil {
+		t.Fatalf("journal missing after interruption: %v", err)
+	}
+
+	s.partPuts, s.partURLs = nil, nil
+	u := testUploader(s, Options{Resume: true, ConcurrentParts: 1})
+	fileInfo, err := u.UploadFile(context.Background(), path, "")
+	if err != nil {
+		t.Fatalf("resumed UploadFile() error = %v", err)
+	}
+
+	if s.nextID != 1 {
+		t.Errorf("%d uploads initialized, want the first one resumed", s.nextID)
+	}
+	if got := fmt.Sprint(s.partPuts); got != "[3 4]" {
+		t.Errorf("parts sent on resume = %s, want [3 4]", got)
+	}
+	if got := fmt.Sprint(s.partURLs); got != "[3 4]" {
+		t.Errorf("part URLs requested on resume = %s, want [3 4]", got)
+	}
+	if fileInfo.ID != "key1" || !bytes.Equal(s.objects["key1"], data) {
+		t.Errorf("stored %s = %q, want %q", fileInfo.ID, s.objects["key1"], data)
+	}
+	if _, err := os.Stat(journalFile); !os.IsNotExist(err) {
+		t.Errorf("journal still present after completion: %v", err)
+	}
+}
+
+func TestUploadFileResumeExpired(t *testing.T) {
+	s := newFakeServer(t, 10)
+	path, data := interruptedUpload(t, s, true)
+
+	// The server dropped the interrupted upload in the meantime
+	s.mu.Lock()
+	delete(s.keys, "1")
+	s.mu.Unlock()
+
+	s.partPuts = nil
+	u := testUploader(s, Options{Resume: true, ConcurrentParts: 1})
+	fileInfo, err := u.UploadFile(context.Background(), path, "")
+	if err != nil {
+		t.Fatalf("resumed UploadFile() error = %v", err)
+	}
+
+	if s.nextID != 2 {
+		t.Errorf("%d uploads initialized, want a fresh one after the first expired", s.nextID)
+	}
+	if got := fmt.Sprint(s.partPuts); got != "[1 2 3 4]" {
+		t.Errorf("parts sent = %s, want all of them again", got)
+	}
+	if fileInfo.ID != "key2" || !bytes.Equal(s.objects["key2"], data) {
+		t.Errorf("stored %s = %q, want %q", fileInfo.ID, s.objects["key2"], data)
+	}
+	journalFile, _ := journalPath(path)
+	if _, err := os.Stat(journalFile); !os.IsNotExist(err) {
+		t.Errorf("journal still present after completion: %v", err)
+	}
+}
+
+func TestUploadFileAbortRemovesJournal(t *testing.T) {
+	s := newFakeServer(t, 10)
+	path, _ := interruptedUpload(t, s, false)
+
+	if len(s.aborted) != 1 || s.aborted[0] != "1" {
+		t.Errorf("aborted uploads = %v, want [1]", s.aborted)
+	}
+	journalFile, _ := journalPath(path)
+	if _, err := os.Stat(journalFile); !os.IsNotExist(err) {
+		t.Errorf("journal still present after abort: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package upload
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AnonymousMaxExpiry is the longest expiry allowed without an account
+const AnonymousMaxExpiry = 3 * 24 * time.Hour
+
+// expiryUnits are the units accepted by ParseExpiry, in addition to RFC 3339
+var expiryUnits = map[byte]time.Duration{
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ParseExpiry parses an expiry given either as a duration from now, like
+// "30m", "12h", "7d", "2w" or "1d12h", or as an RFC 3339 timestamp
+func ParseExpiry(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		if !t.After(now) {
+			return time.Time{}, fmt.Errorf("expiry %s is in the past", s)
+		}
+		return t, nil
+	}
+
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(rest) {
+			return time.Time{}, fmt.Errorf("invalid expiry %q (use e.g. 1h, 7d, 2w or an RFC 3339 time)", s)
+		}
+		unit, ok := expiryUnits[rest[i]]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid expiry unit %q in %q (use m, h, d or w)", rest[i], s)
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expiry %q", s)
+		}
+		total += time.Duration(n) * unit
+		rest = rest[i+1:]
+	}
+
+	if total <= 0 {
+		return time.Time{}, fmt.Errorf("invalid expiry %q (use e.g. 1h, 7d, 2w or an RFC 3339 time)", s)
+	}
+	return now.Add(total), nil
+}
+
+// CheckExpiry returns an error if expires is further than max from now.
+// A max of 0 means no limit.
+func CheckExpiry(expires, now time.Time, max time.Duration) error {
+	if max > 0 && expires.Sub(now) > max+time.Minute {
+		return fmt.Errorf("expiry is beyond the maximum of %s", formatDays(max))
+	}
+	return nil
+}
+
+func formatDays(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
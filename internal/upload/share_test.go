@@ -0,0 +1,51 @@
+package upload
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"30m", 30 * time.Minute},
+		{"1h", time.Hour},
+		{"7d", 7 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"1d12h", 36 * time.Hour},
+		{"2026-01-02T12:00:00Z", 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := ParseExpiry(tt.input, now)
+		if err != nil {
+			t.Errorf("ParseExpiry(%q) error = %v", tt.input, err)
+			continue
+		}
+		if got.Sub(now) != tt.want {
+			t.Errorf("ParseExpiry(%q) = now + %v, want now + %v", tt.input, got.Sub(now), tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "0h", "7", "d", "1y", "1.5h", "-1h", "2025-01-01T00:00:00Z"} {
+		if _, err := ParseExpiry(bad, now); err == nil {
+			t.Errorf("ParseExpiry(%q) should fail", bad)
+		}
+	}
+}
+
+func TestCheckExpiry(t *testing.T) {
+	now := time.Now()
+	if err := CheckExpiry(now.Add(3*24*time.Hour), now, AnonymousMaxExpiry); err != nil {
+		t.Errorf("3 days should be allowed anonymously: %v", err)
+	}
+	if err := CheckExpiry(now.Add(4*24*time.Hour), now, AnonymousMaxExpiry); err == nil {
+		t.Error("4 days should be rejected anonymously")
+	}
+	if err := CheckExpiry(now.Add(365*24*time.Hour), now, 0); err != nil {
+		t.Errorf("no limit should allow any expiry: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/crypt"
+	"github.com/storageto/cli/internal/progress"
+)
+
+// streamThreshold is how much of a stream is buffered before switching to a
+// multipart upload. Shorter streams are sent in a single PUT. It is a
+// variable so tests can stream small inputs.
+var streamThreshold = 16 << 20
+
+// UploadStream uploads data of unknown length, such as stdin. Data is buffered
+// in memory one part at a time, so the stream never has to be written to disk.
+func (u *Uploader) UploadStream(ctx context.Context, r io.Reader, filename string, collectionID string) (*api.FileInfo, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	encrypted := u.opts.EncryptKey != nil
+	if encrypted {
+		enc, err := crypt.NewReader(u.opts.EncryptKey, r)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encrypt input: %w", err)
+		}
+		r = enc
+		filename += crypt.Suffix
+	}
+
+	// Read the head of the stream to detect the content type and find out
+	// whether it fits in a single PUT
+	head := make([]byte, streamThreshold)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("cannot read input: %w", err)
+	}
+	head = head[:n]
+	complete := err != nil
+
+	contentType, ok := contentTypeByExt(filename)
+	if encrypted {
+		contentType = encryptedContentType
+	} else if !ok {
+		contentType = http.DetectContentType(head)
+	}
+
+	var r2Key string
+	var size int64
+	var transfer *progress.Group
+	var task *progress.Task
+	sum := u.newHash()
+	if complete {
+		u.log("Uploading %s (%s)\n", filename, progress.HumanSize(int64(n)))
+		transfer = u.opts.Progress.Group(1, int64(n))
+		task = transfer.Start(filename, int64(n))
+		r2Key, err = u.uploadBuffered(ctx, head, filename, contentType, sum, task)
+		size = int64(n)
+	} else {
+		u.log("Uploading %s (streaming)\n", filename)
+		transfer = u.opts.Progress.Group(1, -1)
+		task = transfer.Start(filename, -1)
+		r2Key, size, err = u.uploadStreaming(ctx, io.MultiReader(bytes.NewReader(head), r), filename, contentType, sum, task)
+	}
+	endTask(task, err)
+	transfer.Done("Uploaded")
+	if err != nil {
+		return nil, err
+	}
+
+	return u.confirmFile(ctx, &api.ConfirmUploadRequest{
+		Filename:     filename,
+		Size:         size,
+		ContentType:  contentType,
+		R2Key:        r2Key,
+		CollectionID: collectionID,
+		Digest:       u.digest(sum),
+	})
+}
+
+// uploadBuffered uploads a stream that was read completely into memory
+func (u *Uploader) uploadBuffered(ctx context.Context, data []byte, filename, contentType string, sum hash.Hash, task *progress.Task) (string, error) {
+	size := int64(len(data))
+	initResp, err := u.client.InitUpload(ctx, &api.InitUploadRequest{
+		Filename:          filename,
+		ContentType:       contentType,
+		Size:              size,
+		ChecksumAlgorithm: u.opts.Checksum,
+		PartSize:          u.opts.PartSize,
+		ShareOptions:      u.opts.Share,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize upload: %w", err)
+	}
+
+	if initResp.Type == "single" {
+		err = u.uploadSingle(ctx, bytes.NewReader(data), initResp.UploadURL, contentType, size, sum, task)
+	} else {
+		u.checkPartSize(filename, initResp.PartSize)
+		err = u.uploadMultipart(ctx, bytes.NewReader(data), initResp, size, nil, sum, task)
+	}
+	if err != nil {
+		return "", err
+	}
+	return initResp.R2Key, nil
+}
+
+// uploadStreaming uploads a stream as a multipart upload of unknown size,
+// reading one part at a time while earlier parts are still in flight.
+// It returns the R2 key and the total number of bytes uploaded. If sum is
+// non-nil, it is fed the stream and each part is sent with its checksum.
+// Progress is reported to task.
+func (u *Uploader) uploadStreaming(ctx context.Context, r io.Reader, filename, contentType string, sum hash.Hash, task *progress.Task) (string, int64, error) {
+	initResp, err := u.client.InitUpload(ctx, &api.InitUploadRequest{
+		Filename:          filename,
+		ContentType:       contentType,
+		Streaming:         true,
+		ChecksumAlgorithm: u.opts.Checksum,
+		PartSize:          u.opts.PartSize,
+		ShareOptions:      u.opts.Share,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to initialize upload: %w", err)
+	}
+	if initResp.Type != "multipart" || initResp.PartSize <= 0 {
+		return "", 0, fmt.Errorf("server does not support streaming uploads")
+	}
+	u.checkPartSize(filename, initResp.PartSize)
+	if initResp.InitialURLs == nil {
+		initResp.InitialURLs = make(map[string]string)
+	}
+
+	// A streamed upload can't be resumed, so abort it on any failure
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			abortCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			u.client.AbortUpload(abortCtx, initResp.UploadID)
+			u.log("Cleaned up partial upload\n")
+		}
+	}()
+
+	var parts []api.Part
+	var partsMu sync.Mutex
+
+	// Buffers are recycled through the semaphore, so at most ConcurrentParts
+	// parts are held in memory at once
+	buffers := make(chan []byte, u.opts.ConcurrentParts)
+	for i := 0; i < u.opts.ConcurrentParts; i++ {
+		buffers <- nil
+	}
+	var wg sync.WaitGroup
+	var uploadErr atomic.Value
+	var total int64
+
+	for partNum := 1; ; partNum++ {
+		if ctx.Err() != nil || uploadErr.Load() != nil {
+			break
+		}
+
+		buf := <-buffers
+		if buf == nil {
+			buf = make([]byte, initResp.PartSize)
+		}
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			buffers <- buf
+			wg.Wait()
+			return "", 0, fmt.Errorf("cannot read input: %w", readErr)
+		}
+		if n == 0 {
+			buffers <- buf
+			break
+		}
+		total += int64(n)
+
+		var partSum hash.Hash
+		if sum != nil {
+			partSum = u.newHash()
+			io.MultiWriter(sum, partSum).Write(buf[:n])
+		}
+
+		partNumStr := strconv.Itoa(partNum)
+		url, ok := initResp.InitialURLs[partNumStr]
+		if !ok {
+			moreURLs, err := u.client.GetPartURLs(ctx, &api.GetPartURLsRequest{
+				UploadID:    initResp.UploadID,
+				PartNumbers: generatePartNumbers(partNum, partNum+u.opts.PartURLBatchSize-1),
+			})
+			if err != nil {
+				buffers <- buf
+				wg.Wait()
+				return "", 0, fmt.Errorf("failed to get upload URLs: %w", err)
+			}
+			for k, v := range moreURLs.URLs {
+				initResp.InitialURLs[k] = v
+			}
+			url = moreURLs.URLs[partNumStr]
+		}
+
+		wg.Add(1)
+		go func(p partUpload, data []byte) {
+			defer wg.Done()
+			defer func() { buffers <- data[:cap(data)] }()
+
+			etag, err := u.uploadPart(ctx, bytes.NewReader(data), p, task)
+			if err != nil {
+				uploadErr.CompareAndSwap(nil, fmt.Errorf("part %d failed: %w", p.number, err))
+				return
+			}
+
+			partsMu.Lock()
+			parts = append(parts, api.Part{PartNumber: p.number, ETag: etag})
+			partsMu.Unlock()
+		}(u.newPartUpload(initResp.UploadID, partNum, url, 0, int64(n), partSum), buf[:n])
+
+		if readErr != nil {
+			break // End of stream
+		}
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return "", 0, fmt.Errorf("upload cancelled")
+	}
+	if err := uploadErr.Load(); err != nil {
+		return "", 0, err.(error)
+	}
+
+	_, err = u.client.CompleteMultipart(ctx, &api.CompleteMultipartRequest{
+		UploadID: initResp.UploadID,
+		Parts:    parts,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to complete upload: %w", err)
+	}
+
+	succeeded = true
+	return initResp.R2Key, total, nil
+}
@@ -0,0 +1,64 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestUploadStreamBuffered(t *testing.T) {
+	s := newFakeServer(t, 10)
+	u := testUploader(s, Options{})
+
+	fileInfo, err := u.UploadStream(context.Background(), strings.NewReader("hello"), "hello.txt", "")
+	if err != nil {
+		t.Fatalf("UploadStream() error = %v", err)
+	}
+	if len(s.singlePuts) != 1 || len(s.partPuts) != 0 {
+		t.Errorf("single PUTs = %v, parts = %v, want one single PUT", s.singlePuts, s.partPuts)
+	}
+	if fileInfo.Size != 5 || string(s.objects[fileInfo.ID]) != "hello" {
+		t.Errorf("stored %q (size %d), want hello", s.objects[fileInfo.ID], fileInfo.Size)
+	}
+}
+
+func TestUploadStreamMultipart(t *testing.T) {
+	defer func(threshold int) { streamThreshold = threshold }(streamThreshold)
+	streamThreshold = 16
+
+	tests := []struct {
+		name  string
+		data  string
+		parts []string
+	}{
+		{"short last part", "0123456789abcdefghijklmnopq", []string{"0123456789", "abcdefghij", "klmnopq"}},
+		{"whole parts", "0123456789abcdefghij", []string{"0123456789", "abcdefghij"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeServer(t, 10)
+			u := testUploader(s, Options{ConcurrentParts: 2})
+
+			fileInfo, err := u.UploadStream(context.Background(), strings.NewReader(tt.data), "data.bin", "")
+			if err != nil {
+				t.Fatalf("UploadStream() error = %v", err)
+			}
+			if len(s.singlePuts) != 0 || len(s.completed) != 1 {
+				t.Fatalf("single PUTs = %v, completed = %v, want one multipart upload", s.singlePuts, s.completed)
+			}
+			parts := s.parts[s.completed[0]]
+			if len(parts) != len(tt.parts) {
+				t.Fatalf("got %d parts, want %d", len(parts), len(tt.parts))
+			}
+			for i, want := range tt.parts {
+				if got := string(parts[i+1]); got != want {
+					t.Errorf("part %d = %q, want %q", i+1, got, want)
+				}
+			}
+			if fileInfo.Size != int64(len(tt.data)) || !bytes.Equal(s.objects[fileInfo.ID], []byte(tt.data)) {
+				t.Errorf("stored %q (size %d), want %q", s.objects[fileInfo.ID], fileInfo.Size, tt.data)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package upload
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
@@ -14,40 +17,126 @@ import (
 	"time"
 
 	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/crypt"
+	"github.com/storageto/cli/internal/progress"
+	"github.com/storageto/cli/internal/retry"
+	"github.com/storageto/cli/internal/throttle"
 	"github.com/storageto/cli/internal/version"
 )
 
 const (
-	maxRetries       = 3
-	retryDelay       = 2 * time.Second
-	concurrentParts  = 4
-	concurrentFiles  = 6   // Concurrent file uploads (matches web/desktop)
-	batchSize        = 250 // Max files per batch API call
-	partURLBatchSize = 50
-	uploadTimeout    = 30 * time.Minute
+	uploadTimeout = 30 * time.Minute
 )
 
+// Defaults and upper bounds for the concurrency and batching Options
+const (
+	DefaultConcurrentFiles = 6 // Matches web/desktop
+	MaxConcurrentFiles     = 32
+	DefaultConcurrentParts = 4
+	MaxConcurrentParts     = 32
+	MaxBatchSize           = 250 // Max files per batch API call
+	MaxPartURLBatchSize    = 50
+	// Storage accepts parts of 5 MB to 5 GB; only the last one may be smaller
+	MinPartSize = 5 << 20
+	MaxPartSize = 5 << 30
+)
+
+// Options configures an Uploader
+type Options struct {
+	Verbose bool
+	// Resume continues multipart uploads recorded in the resume journal and
+	// keeps cancelled uploads resumable instead of aborting them. Encrypted
+	// uploads are never journaled since the key only lives for one run, and
+	// neither are batch uploads; only UploadFile of a single file resumes.
+	Resume bool
+	// EncryptKey, if set, encrypts all content with crypt before upload
+	EncryptKey []byte
+	// Share is sent with every upload and collection
+	Share api.ShareOptions
+	// Password protects uploaded files, or the collection they are in
+	Password string
+	// Collection, if set, is an existing collection that UploadFiles adds
+	// the files to instead of creating a new one
+	Collection string
+	// Retry is the policy for failed uploads to storage. retry.Default is
+	// used if Attempts is 0.
+	Retry retry.Policy
+
+	// ConcurrentFiles and ConcurrentParts limit how many files, and parts
+	// of each multipart upload, are sent at once. Each streamed part in
+	// flight holds a part-sized buffer, as does each part sent with a
+	// Checksum.
+	ConcurrentFiles int
+	ConcurrentParts int
+	// BatchSize is the number of files per batch API call and
+	// PartURLBatchSize the number of part URLs requested at once.
+	BatchSize        int
+	PartURLBatchSize int
+	// PartSize, if set, is the part size in bytes asked for with multipart
+	// uploads, between MinPartSize and MaxPartSize. The server may adjust
+	// it, which is reported through Progress.
+	PartSize int64
+	// LimitRate caps the combined upload bandwidth in bytes per second.
+	// Zero means unlimited.
+	LimitRate int64
+	// Checksum, if set, is ChecksumSHA256 or ChecksumCRC32C. Every PUT, of
+	// a whole file or of a part, carries its checksum for storage to verify
+	// and the file's digest is confirmed with the server.
+	Checksum string
+	// Progress shows the progress of uploads and messages about them.
+	// Nothing is shown if it is nil.
+	Progress *progress.Display
+	// Dedup hashes files before upload. Files whose content the server
+	// already has, or that repeat another file of the same batch, are
+	// confirmed with the stored content instead of being sent again. It
+	// can't be combined with EncryptKey.
+	Dedup bool
+}
+
 // Uploader handles file uploads to storage.to
 type Uploader struct {
 	client  *api.Client
-	verbose bool
+	opts    Options
+	limiter *throttle.Limiter // Shared by all concurrent uploads
 }
 
 // NewUploader creates a new uploader
-func NewUploader(client *api.Client, verbose bool) *Uploader {
+func NewUploader(client *api.Client, opts Options) *Uploader {
+	if opts.Retry.Attempts == 0 {
+		opts.Retry = retry.Default
+	}
+	// Encrypted content differs from the local file on every upload
+	if opts.EncryptKey != nil {
+		opts.Dedup = false
+	}
+	// Zero means the default, anything else is kept within bounds
+	opts.ConcurrentFiles = bound(opts.ConcurrentFiles, DefaultConcurrentFiles, MaxConcurrentFiles)
+	opts.ConcurrentParts = bound(opts.ConcurrentParts, DefaultConcurrentParts, MaxConcurrentParts)
+	opts.BatchSize = bound(opts.BatchSize, MaxBatchSize, MaxBatchSize)
+	opts.PartURLBatchSize = bound(opts.PartURLBatchSize, MaxPartURLBatchSize, MaxPartURLBatchSize)
 	return &Uploader{
 		client:  client,
-		verbose: verbose,
+		opts:    opts,
+		limiter: throttle.NewLimiter(opts.LimitRate),
 	}
 }
 
 // Result contains the upload result
 type Result struct {
-	FileInfo     *api.FileInfo
-	Collection   *api.CollectionInfo
-	IsCollection bool
+	FileInfo      *api.FileInfo
+	Collection    *api.CollectionInfo
+	IsCollection  bool
+	EncryptionKey string `json:",omitempty"`
+	// Checksums maps the filenames of a collection upload to their hex
+	// digest when Options.Checksum is set. Single files carry theirs in
+	// FileInfo.
+	ChecksumAlgorithm string            `json:",omitempty"`
+	Checksums         map[string]string `json:",omitempty"`
 }
 
+// encryptedContentType is sent for encrypted uploads, whose content can't be sniffed
+const encryptedContentType = "application/octet-stream"
+
 // UploadFile uploads a single file
 func (u *Uploader) UploadFile(ctx context.Context, path string, collectionID string) (*api.FileInfo, error) {
 	// Check for cancellation
@@ -74,42 +163,173 @@ func (u *Uploader) UploadFile(ctx context.Context, path string, collectionID str
 	// Reset file position after content type detection
 	file.Seek(0, 0)
 
-	u.log("Uploading %s (%s)\n", filename, humanSize(size))
+	// When encrypting, the ciphertext is what gets uploaded
+	var body io.ReaderAt = file
+	if u.opts.EncryptKey != nil {
+		enc, err := crypt.NewReaderAt(u.opts.EncryptKey, file, size)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encrypt file: %w", err)
+		}
+		body = enc
+		size = enc.Size()
+		filename += crypt.Suffix
+		contentType = encryptedContentType
+	}
 
-	// Initialize upload
-	initResp, err := u.client.InitUpload(ctx, &api.InitUploadRequest{
-		Filename:    filename,
-		ContentType: contentType,
-		Size:        size,
-	})
+	// Link to identical content uploaded before instead of sending it again
+	if u.opts.Dedup {
+		fileInfo, err := u.linkExisting(ctx, file, filename, contentType, size, collectionID)
+		if err != nil || fileInfo != nil {
+			return fileInfo, err
+		}
+	}
+
+	u.log("Uploading %s (%s)\n", filename, progress.HumanSize(size))
+
+	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize upload: %w", err)
+		return nil, fmt.Errorf("cannot resolve path: %w", err)
+	}
+
+	// Pick up an interrupted multipart upload of the same file if asked to
+	var j *journal
+	var initResp *api.InitUploadResponse
+	journaled := u.opts.EncryptKey == nil
+	if u.opts.Resume && journaled {
+		j, err = loadJournal(absPath, file, stat)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read resume journal: %w", err)
+		}
+		if j != nil && j.CollectionID != collectionID {
+			j = nil
+		}
+		if j != nil {
+			initResp, err = u.resumeUpload(ctx, j)
+			if err != nil {
+				return nil, err
+			}
+			if initResp != nil {
+				u.opts.Progress.Printf("Resuming upload of %s (%d/%d parts done)\n", filename, len(j.Parts), j.TotalParts)
+			} else {
+				u.opts.Progress.Warnf("Cannot resume %s: the upload expired on the server, starting over\n", filename)
+				j.remove()
+				j = nil
+			}
+		}
+	}
+
+	if initResp == nil {
+		// Initialize upload
+		initResp, err = u.client.InitUpload(ctx, &api.InitUploadRequest{
+			Filename:          filename,
+			ContentType:       contentType,
+			Size:              size,
+			ChecksumAlgorithm: u.opts.Checksum,
+			PartSize:          u.opts.PartSize,
+			ShareOptions:      u.opts.Share,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize upload: %w", err)
+		}
+
+		if initResp.Type != "single" {
+			u.checkPartSize(filename, initResp.PartSize)
+		}
+		if initResp.Type != "single" && journaled {
+			j, err = newJournal(absPath, file, stat, filename, contentType, collectionID, initResp)
+			if err != nil {
+				u.log("Cannot write resume journal: %v\n", err)
+			}
+		}
 	}
 
 	// Upload based on type
+	transfer := u.opts.Progress.Group(1, size)
+	task := transfer.Start(filename, size)
+	sum := u.newHash()
 	if initResp.Type == "single" {
-		err = u.uploadSingle(ctx, file, initResp.UploadURL, contentType, size)
+		err = u.uploadSingle(ctx, io.NewSectionReader(body, 0, size), initResp.UploadURL, contentType, size, sum, task)
 	} else {
-		err = u.uploadMultipart(ctx, file, initResp, size)
+		err = u.uploadMultipart(ctx, body, initResp, size, j, sum, task)
 	}
+	endTask(task, err)
+	transfer.Done("Uploaded")
 	if err != nil {
 		return nil, err
 	}
 
 	// Confirm upload. CRC-32 is computed server-side from R2 by the
 	// ComputeFileSha256 job — no need to re-scan the local file here.
-	confirmResp, err := u.client.ConfirmUpload(ctx, &api.ConfirmUploadRequest{
+	// With --checksum the digest computed during the upload is sent along.
+	fileInfo, err := u.confirmFile(ctx, &api.ConfirmUploadRequest{
 		Filename:     filename,
 		Size:         size,
 		ContentType:  contentType,
 		R2Key:        initResp.R2Key,
 		CollectionID: collectionID,
+		Digest:       u.digest(sum),
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	if j != nil {
+		j.remove()
+	}
+
+	return fileInfo, nil
+}
+
+// resumeUpload rebuilds the init response of a journaled upload and fetches
+// URLs for the parts still to send. It returns nil if the server no longer
+// knows the upload, e.g. because it expired.
+func (u *Uploader) resumeUpload(ctx context.Context, j *journal) (*api.InitUploadResponse, error) {
+	initResp := j.initResponse()
+	done := make(map[int]bool)
+	for _, p := range j.completedParts() {
+		done[p.PartNumber] = true
+	}
+	pending := pendingParts(1, initResp.TotalParts, done, u.opts.PartURLBatchSize)
+	if len(pending) == 0 {
+		return initResp, nil
+	}
+
+	resp, err := u.client.GetPartURLs(ctx, &api.GetPartURLsRequest{
+		UploadID:    initResp.UploadID,
+		PartNumbers: pending,
+	})
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) && apiErr.Code == api.CodeNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload URLs: %w", err)
+	}
+	for k, v := range resp.URLs {
+		initResp.InitialURLs[k] = v
+	}
+	return initResp, nil
+}
+
+// confirmFile creates the file record for uploaded content, adding the
+// password and share options
+func (u *Uploader) confirmFile(ctx context.Context, req *api.ConfirmUploadRequest) (*api.FileInfo, error) {
+	req.Password = u.filePassword(req.CollectionID)
+	req.ShareOptions = u.opts.Share
+	confirmResp, err := u.client.ConfirmUpload(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to confirm upload: %w", err)
 	}
+	u.emitConfirmed(req.Filename, confirmResp.File)
+	return withDigest(confirmResp.File, req.Digest), nil
+}
 
-	return confirmResp.File, nil
+// File is a local file to upload along with the name it gets in storage.to
+type File struct {
+	Path string
+	// Name is the filename shown to recipients. For files uploaded from a
+	// directory it is the slash-separated relative path (e.g. src/pkg/a.go).
+	Name string
 }
 
 // fileMetadata holds information about a file to upload
@@ -117,23 +337,30 @@ type fileMetadata struct {
 	path        string
 	filename    string
 	contentType string
-	size        int64
+	size        int64 // Bytes to upload
+	localSize   int64 // Bytes on disk; smaller than size when encrypting
 	index       int
 	// Set after init
 	uploadURL string
 	r2Key     string
+	initResp  *api.InitUploadResponse // Non-nil for multipart uploads
+	started   bool                    // Set when sending the content began
 	uploadErr error
+	digest    api.Digest // Set after upload if checksums are on
+	// Set with Options.Dedup
+	hash   string        // Hex SHA-256 of the content
+	sameAs *fileMetadata // Earlier file of the batch with the same content
 }
 
 // UploadFiles uploads multiple files, optionally as a collection
-func (u *Uploader) UploadFiles(ctx context.Context, paths []string, asCollection bool) (*Result, error) {
-	if len(paths) == 0 {
+func (u *Uploader) UploadFiles(ctx context.Context, files []File, asCollection bool) (*Result, error) {
+	if len(files) == 0 {
 		return nil, fmt.Errorf("no files specified")
 	}
 
 	// Single file, no collection
-	if len(paths) == 1 && !asCollection {
-		fileInfo, err := u.UploadFile(ctx, paths[0], "")
+	if len(files) == 1 && !asCollection && u.opts.Collection == "" {
+		fileInfo, err := u.UploadFile(ctx, files[0].Path, "")
 		if err != nil {
 			return nil, err
 		}
@@ -141,14 +368,20 @@ func (u *Uploader) UploadFiles(ctx context.Context, paths []string, asCollection
 	}
 
 	// Multiple files - use batch upload with concurrency
-	return u.uploadFilesBatch(ctx, paths)
+	return u.uploadFilesBatch(ctx, files)
 }
 
 // uploadFilesBatch uploads multiple files using batch API endpoints and concurrent R2 uploads
-func (u *Uploader) uploadFilesBatch(ctx context.Context, paths []string) (*Result, error) {
+func (u *Uploader) uploadFilesBatch(ctx context.Context, inputs []File) (*Result, error) {
 	// Step 1: Collect file metadata
-	files := make([]*fileMetadata, 0, len(paths))
-	for i, path := range paths {
+	files := make([]*fileMetadata, 0, len(inputs))
+	for i, input := range inputs {
+		path := input.Path
+		name := input.Name
+		if name == "" {
+			name = filepath.Base(path)
+		}
+
 		file, err := os.Open(path)
 		if err != nil {
 			return nil, fmt.Errorf("cannot open %s: %w", path, err)
@@ -161,39 +394,80 @@ func (u *Uploader) uploadFilesBatch(ctx context.Context, paths []string) (*Resul
 		}
 
 		contentType := detectContentType(path, file)
+		var contentHash string
+		var digest api.Digest
+		if u.opts.Dedup {
+			file.Seek(0, 0)
+			contentHash, digest, err = u.contentHash(file)
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("cannot read %s: %w", path, err)
+			}
+		}
 		file.Close()
 
+		size := stat.Size()
+		if u.opts.EncryptKey != nil {
+			name += crypt.Suffix
+			contentType = encryptedContentType
+			size = crypt.EncryptedSize(stat.Size())
+		}
+
 		files = append(files, &fileMetadata{
 			path:        path,
-			filename:    filepath.Base(path),
+			filename:    name,
 			contentType: contentType,
-			size:        stat.Size(),
+			size:        size,
+			localSize:   stat.Size(),
 			index:       i,
+			hash:        contentHash,
+			digest:      digest,
 		})
 	}
 
-	// Step 2: Create collection
-	collResp, err := u.client.CreateCollection(ctx, &api.CreateCollectionRequest{
-		ExpectedFileCount: len(files),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create collection: %w", err)
+	// Only files with new content are uploaded
+	pending := files
+	if u.opts.Dedup {
+		var err error
+		if pending, err = u.dedup(ctx, files); err != nil {
+			return nil, err
+		}
+	}
+
+	// Step 2: Create collection, unless adding to an existing one
+	collectionID := u.opts.Collection
+	if collectionID == "" {
+		collResp, err := u.client.CreateCollection(ctx, &api.CreateCollectionRequest{
+			ExpectedFileCount: len(files),
+			Password:          u.opts.Password,
+			ShareOptions:      u.opts.Share,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create collection: %w", err)
+		}
+		collectionID = collResp.Collection.ID
+		u.log("Created collection %s for %d files\n", collectionID, len(files))
+	} else {
+		u.log("Adding %d files to collection %s\n", len(files), collectionID)
 	}
-	collectionID := collResp.Collection.ID
-	u.log("Created collection %s for %d files\n", collectionID, len(files))
 
 	// Step 3: Batch init - get presigned URLs for all files
-	fmt.Printf("Initializing %d files...\n", len(files))
-	for batchStart := 0; batchStart < len(files); batchStart += batchSize {
-		batchEnd := batchStart + batchSize
-		if batchEnd > len(files) {
-			batchEnd = len(files)
+	if len(pending) > 0 {
+		u.opts.Progress.Printf("Initializing %d files...\n", len(pending))
+	}
+	for batchStart := 0; batchStart < len(pending); batchStart += u.opts.BatchSize {
+		batchEnd := batchStart + u.opts.BatchSize
+		if batchEnd > len(pending) {
+			batchEnd = len(pending)
 		}
-		batch := files[batchStart:batchEnd]
+		batch := pending[batchStart:batchEnd]
 
 		// Build batch request
 		batchReq := &api.InitBatchRequest{
-			Files: make([]api.BatchFileRequest, len(batch)),
+			Files:             make([]api.BatchFileRequest, len(batch)),
+			ChecksumAlgorithm: u.opts.Checksum,
+			PartSize:          u.opts.PartSize,
+			ShareOptions:      u.opts.Share,
 		}
 		for i, f := range batch {
 			batchReq.Files[i] = api.BatchFileRequest{
@@ -215,27 +489,50 @@ func (u *Uploader) uploadFilesBatch(ctx context.Context, paths []string) (*Resul
 			if result, ok := initResp.Results[idxStr]; ok {
 				if result.Error != "" {
 					f.uploadErr = fmt.Errorf("%s", result.Error)
+					u.opts.Progress.Emit(progress.Event{Type: progress.Error, File: f.filename, Error: result.Error})
 				} else {
 					f.uploadURL = result.UploadURL
 					f.r2Key = result.R2Key
+					if result.Type == "multipart" {
+						f.initResp = &api.InitUploadResponse{
+							Type:        result.Type,
+							UploadID:    result.UploadID,
+							R2Key:       result.R2Key,
+							PartSize:    result.PartSize,
+							TotalParts:  result.TotalParts,
+							InitialURLs: result.InitialURLs,
+						}
+						u.checkPartSize(f.filename, result.PartSize)
+					}
 				}
 			}
 		}
 	}
 
-	// Step 4: Upload to R2 concurrently (6 at a time)
-	fmt.Printf("Uploading %d files (6 concurrent)...\n", len(files))
+	// Step 4: Upload to R2 concurrently
+	var uploadFiles int
+	var uploadBytes int64
+	for _, f := range pending {
+		if f.uploadErr == nil && (f.uploadURL != "" || f.initResp != nil) {
+			uploadFiles++
+			uploadBytes += f.size
+		}
+	}
+	var transfer *progress.Group
+	if uploadFiles > 0 {
+		u.opts.Progress.Printf("Uploading %d files (%d concurrent)...\n", uploadFiles, u.opts.ConcurrentFiles)
+		transfer = u.opts.Progress.Group(uploadFiles, uploadBytes)
+	}
 
 	var wg sync.WaitGroup
-	sem := make(chan struct{}, concurrentFiles)
-	var uploadedCount int64
+	sem := make(chan struct{}, u.opts.ConcurrentFiles)
 	var errorCount int64
 
-	for _, f := range files {
+	for _, f := range pending {
 		if ctx.Err() != nil {
 			break
 		}
-		if f.uploadErr != nil || f.uploadURL == "" {
+		if f.uploadErr != nil || (f.uploadURL == "" && f.initResp == nil) {
 			atomic.AddInt64(&errorCount, 1)
 			continue
 		}
@@ -247,32 +544,42 @@ func (u *Uploader) uploadFilesBatch(ctx context.Context, paths []string) (*Resul
 			defer wg.Done()
 			defer func() { <-sem }() // Release
 
-			err := u.uploadFileToR2(ctx, fm)
+			fm.started = true
+			task := transfer.Start(fm.filename, fm.size)
+			err := u.uploadFileToR2(ctx, fm, task)
+			endTask(task, err)
 			if err != nil {
 				fm.uploadErr = err
 				atomic.AddInt64(&errorCount, 1)
-			} else {
-				n := atomic.AddInt64(&uploadedCount, 1)
-				fmt.Printf("\r  Uploaded %d/%d files", n, len(files))
 			}
 		}(f)
 	}
 	wg.Wait()
-	fmt.Println() // newline after progress
+	transfer.Done("Uploaded")
+	u.abortUnfinished(ctx, pending)
 
-	// Step 5: Batch confirm - create File records
-	fmt.Printf("Confirming %d files...\n", uploadedCount)
+	// Duplicates share the content of the file they repeat
+	for _, f := range files {
+		if f.sameAs != nil {
+			f.r2Key = f.sameAs.r2Key
+			f.uploadErr = f.sameAs.uploadErr
+			if f.r2Key == "" || f.uploadErr != nil {
+				errorCount++
+			}
+		}
+	}
 
-	// Collect successfully uploaded files
+	// Step 5: Batch confirm - create File records
 	var toConfirm []*fileMetadata
 	for _, f := range files {
 		if f.uploadErr == nil && f.r2Key != "" {
 			toConfirm = append(toConfirm, f)
 		}
 	}
+	u.opts.Progress.Printf("Confirming %d files...\n", len(toConfirm))
 
-	for batchStart := 0; batchStart < len(toConfirm); batchStart += batchSize {
-		batchEnd := batchStart + batchSize
+	for batchStart := 0; batchStart < len(toConfirm); batchStart += u.opts.BatchSize {
+		batchEnd := batchStart + u.opts.BatchSize
 		if batchEnd > len(toConfirm) {
 			batchEnd = len(toConfirm)
 		}
@@ -283,6 +590,7 @@ func (u *Uploader) uploadFilesBatch(ctx context.Context, paths []string) (*Resul
 		confirmReq := &api.ConfirmBatchRequest{
 			CollectionID: collectionID,
 			Files:        make([]api.BatchConfirmFile, len(batch)),
+			ShareOptions: u.opts.Share,
 		}
 		for i, f := range batch {
 			confirmReq.Files[i] = api.BatchConfirmFile{
@@ -290,67 +598,155 @@ func (u *Uploader) uploadFilesBatch(ctx context.Context, paths []string) (*Resul
 				Size:        f.size,
 				ContentType: f.contentType,
 				R2Key:       f.r2Key,
+				Digest:      f.digest,
 			}
 		}
 
 		// Call confirm-batch
-		_, err := u.client.ConfirmUploadBatch(ctx, confirmReq)
+		confirmResp, err := u.client.ConfirmUploadBatch(ctx, confirmReq)
 		if err != nil {
 			return nil, fmt.Errorf("failed to confirm batch: %w", err)
 		}
+		for i, f := range batch {
+			result := confirmResp.Results[strconv.Itoa(i)]
+			if result.Error != "" {
+				u.opts.Progress.Emit(progress.Event{Type: progress.Error, File: f.filename, Error: result.Error})
+			} else {
+				u.emitConfirmed(f.filename, result.File)
+			}
+		}
 	}
 
 	// Step 6: Mark collection ready
-	readyResp, err := u.client.MarkCollectionReady(ctx, collectionID)
+	result, err := u.FinishCollection(ctx, collectionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to finalize collection: %w", err)
+		return nil, err
 	}
 
 	if errorCount > 0 {
-		fmt.Printf("Warning: %d files failed to upload\n", errorCount)
+		u.opts.Progress.Warnf("Warning: %d files failed to upload\n", errorCount)
 	}
 
+	if u.opts.Checksum != "" {
+		result.ChecksumAlgorithm = u.opts.Checksum
+		result.Checksums = make(map[string]string, len(toConfirm))
+		for _, f := range toConfirm {
+			result.Checksums[f.filename] = f.digest.Checksum
+		}
+	}
+	return result, nil
+}
+
+// abortUnfinished aborts the multipart uploads that init-batch started for
+// files that were never sent, e.g. after Ctrl+C, or that failed. Those
+// cancelled while being sent were already aborted by uploadMultipart.
+func (u *Uploader) abortUnfinished(ctx context.Context, files []*fileMetadata) {
+	cancelled := ctx.Err() != nil
+	for _, f := range files {
+		if f.initResp == nil || f.started && (f.uploadErr == nil || cancelled) {
+			continue
+		}
+		// Best effort abort - use background context since ctx may be cancelled
+		abortCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		u.client.AbortUpload(abortCtx, f.initResp.UploadID)
+		cancel()
+		u.log("Cleaned up partial upload of %s\n", f.filename)
+	}
+}
+
+// FinishCollection marks a collection ready after files were uploaded to
+// it. Collections that get more files later are finalized again.
+func (u *Uploader) FinishCollection(ctx context.Context, collectionID string) (*Result, error) {
+	readyResp, err := u.client.MarkCollectionReady(ctx, collectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize collection: %w", err)
+	}
+	if c := readyResp.Collection; c != nil {
+		u.opts.Progress.Emit(progress.Event{Type: progress.CollectionReady, Collection: c.ID, URL: c.URL})
+	}
 	return &Result{
 		Collection:   readyResp.Collection,
 		IsCollection: true,
 	}, nil
 }
 
-// uploadFileToR2 uploads a single file to R2 using a presigned URL
-func (u *Uploader) uploadFileToR2(ctx context.Context, fm *fileMetadata) error {
+// uploadFileToR2 uploads a single file to R2, either with one presigned PUT
+// or as a multipart upload when the server chose that for the file
+func (u *Uploader) uploadFileToR2(ctx context.Context, fm *fileMetadata, task *progress.Task) error {
 	file, err := os.Open(fm.path)
 	if err != nil {
 		return fmt.Errorf("cannot open file: %w", err)
 	}
 	defer file.Close()
 
-	return u.uploadSingle(ctx, file, fm.uploadURL, fm.contentType, fm.size)
+	var body io.ReaderAt = file
+	if u.opts.EncryptKey != nil {
+		body, err = crypt.NewReaderAt(u.opts.EncryptKey, file, fm.localSize)
+		if err != nil {
+			return fmt.Errorf("cannot encrypt file: %w", err)
+		}
+	}
+
+	sum := u.newHash()
+	if fm.initResp != nil {
+		err = u.uploadMultipart(ctx, body, fm.initResp, fm.size, nil, sum, task)
+	} else {
+		err = u.uploadSingle(ctx, io.NewSectionReader(body, 0, fm.size), fm.uploadURL, fm.contentType, fm.size, sum, task)
+	}
+	fm.digest = u.digest(sum)
+	return err
 }
 
-// uploadSingle uploads a file in a single PUT request
-func (u *Uploader) uploadSingle(ctx context.Context, file *os.File, uploadURL string, contentType string, size int64) error {
-	return u.uploadWithRetry(ctx, func() error {
+// uploadSingle uploads a file in a single PUT request, reporting progress
+// to task. If sum is non-nil, the PUT carries the checksum for storage to
+// verify. The checksum has to be sent before the data, so the file is
+// buffered like a part and both are computed from the one read.
+func (u *Uploader) uploadSingle(ctx context.Context, file io.ReadSeeker, uploadURL string, contentType string, size int64, sum hash.Hash, task *progress.Task) error {
+	var checksumHeader, checksum string
+	if sum != nil {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(file, data); err != nil {
+			return fmt.Errorf("cannot read file: %w", err)
+		}
+		sum.Write(data)
+		checksumHeader, checksum = u.checksumHeader(sum)
+		file = bytes.NewReader(data)
+	}
+
+	return u.withRetry(ctx, task, 0, func() (err error) {
+		// Bytes of a failed attempt no longer count, they are sent again
+		var reported int64
+		defer func() {
+			if err != nil {
+				task.Add(-reported)
+			}
+		}()
+
 		file.Seek(0, 0)
 
 		// Create context with timeout for the upload
 		uploadCtx, cancel := context.WithTimeout(ctx, uploadTimeout)
 		defer cancel()
 
-		pr := &progressReader{
-			reader: file,
-			total:  size,
-			onProgress: func(uploaded, total int64) {
-				u.printProgress(uploaded, total)
+		pr := &progress.Reader{
+			Reader: u.limiter.Reader(uploadCtx, file),
+			Total:  size,
+			OnProgress: func(uploaded, _ int64) {
+				task.Add(uploaded - reported)
+				reported = uploaded
 			},
 		}
 
 		req, err := http.NewRequestWithContext(uploadCtx, "PUT", uploadURL, pr)
 		if err != nil {
-			return err
+			return retry.Permanent(err)
 		}
 
 		req.Header.Set("Content-Type", contentType)
 		req.Header.Set("User-Agent", version.UserAgent())
+		if checksum != "" {
+			req.Header.Set(checksumHeader, checksum)
+		}
 		req.ContentLength = size
 
 		client := &http.Client{}
@@ -367,38 +763,62 @@ func (u *Uploader) uploadSingle(ctx context.Context, file *os.File, uploadURL st
 		defer resp.Body.Close()
 
 		if resp.StatusCode >= 400 {
-			body, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("upload failed (HTTP %d): %s", resp.StatusCode, string(body))
+			return putFailure(resp).retryError()
 		}
 
-		fmt.Println() // newline after progress
 		return nil
 	})
 }
 
-// uploadMultipart uploads a file in multiple parts
-func (u *Uploader) uploadMultipart(ctx context.Context, file *os.File, initResp *api.InitUploadResponse, size int64) error {
-	u.log("Multipart upload: %d parts, %s each\n", initResp.TotalParts, humanSize(initResp.PartSize))
+// uploadMultipart uploads a file in multiple parts, reporting progress to
+// task. If j is non-nil, completed parts are recorded in it and parts it
+// already lists are skipped. If sum is non-nil, it is fed the whole file and
+// each part is sent with its checksum. The checksum goes in the headers, so
+// such parts are read once into a buffer that is hashed and sent from; at
+// most ConcurrentParts buffers are in use.
+func (u *Uploader) uploadMultipart(ctx context.Context, file io.ReaderAt, initResp *api.InitUploadResponse, size int64, j *journal, sum hash.Hash, task *progress.Task) error {
+	u.log("Multipart upload: %d parts, %s each\n", initResp.TotalParts, progress.HumanSize(initResp.PartSize))
 
-	// Abort cleanup on cancellation
+	// Abort cleanup on cancellation, unless the upload should stay resumable
 	defer func() {
-		if ctx.Err() != nil && initResp.UploadID != "" {
-			// Best effort abort - use background context since main ctx is cancelled
-			abortCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			u.client.AbortUpload(abortCtx, initResp.UploadID)
-			u.log("Cleaned up partial upload\n")
+		if ctx.Err() == nil || initResp.UploadID == "" {
+			return
+		}
+		if u.opts.Resume && j != nil {
+			u.opts.Progress.Warnf("Upload paused - run the same command with --resume to continue\n")
+			return
+		}
+		if j != nil {
+			j.remove()
 		}
+
+		// Best effort abort - use background context since main ctx is cancelled
+		abortCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		u.client.AbortUpload(abortCtx, initResp.UploadID)
+		u.log("Cleaned up partial upload\n")
 	}()
 
-	// Track completed parts
+	if initResp.InitialURLs == nil {
+		initResp.InitialURLs = make(map[string]string)
+	}
+
+	// Track completed parts, starting from any recorded in the journal
 	var parts []api.Part
 	var partsMu sync.Mutex
-	var uploadedBytes int64
-	var uploadedMu sync.Mutex
+
+	done := make(map[int]bool)
+	if j != nil {
+		parts = j.completedParts()
+		for _, p := range parts {
+			done[p.PartNumber] = true
+			task.Skip(partLength(p.PartNumber, initResp.PartSize, initResp.TotalParts, size))
+		}
+	}
 
 	// Semaphore for concurrent uploads
-	sem := make(chan struct{}, concurrentParts)
+	sem := make(chan struct{}, u.opts.ConcurrentParts)
+	buffers := make(chan []byte, u.opts.ConcurrentParts)
 	var wg sync.WaitGroup
 	var uploadErr atomic.Value
 
@@ -412,6 +832,21 @@ func (u *Uploader) uploadMultipart(ctx context.Context, file *os.File, initResp
 			break
 		}
 
+		// Calculate part boundaries
+		offset := int64(partNum-1) * initResp.PartSize
+		partSize := partLength(partNum, initResp.PartSize, initResp.TotalParts, size)
+
+		if done[partNum] {
+			// The file's digest still needs the parts sent before
+			if sum != nil {
+				if _, err := io.Copy(sum, io.NewSectionReader(file, offset, partSize)); err != nil {
+					uploadErr.CompareAndSwap(nil, fmt.Errorf("cannot read part %d: %w", partNum, err))
+					break
+				}
+			}
+			continue
+		}
+
 		// Get URL for this part
 		partNumStr := strconv.Itoa(partNum)
 		url, ok := initResp.InitialURLs[partNumStr]
@@ -419,7 +854,7 @@ func (u *Uploader) uploadMultipart(ctx context.Context, file *os.File, initResp
 			// Fetch more URLs
 			moreURLs, err := u.client.GetPartURLs(ctx, &api.GetPartURLsRequest{
 				UploadID:    initResp.UploadID,
-				PartNumbers: generatePartNumbers(partNum, min(partNum+partURLBatchSize-1, initResp.TotalParts)),
+				PartNumbers: pendingParts(partNum, initResp.TotalParts, done, u.opts.PartURLBatchSize),
 			})
 			if err != nil {
 				return fmt.Errorf("failed to get upload URLs: %w", err)
@@ -431,43 +866,55 @@ func (u *Uploader) uploadMultipart(ctx context.Context, file *os.File, initResp
 			url = moreURLs.URLs[partNumStr]
 		}
 
-		// Calculate part boundaries
-		offset := int64(partNum-1) * initResp.PartSize
-		partSize := initResp.PartSize
-		if partNum == initResp.TotalParts {
-			partSize = size - offset // Last part may be smaller
+		sem <- struct{}{} // Acquire semaphore
+
+		// Parts are hashed here, in order, so the file's digest and the
+		// part's checksum come from the one read of the part
+		body, bodyOffset := file, offset
+		var data []byte
+		var partSum hash.Hash
+		if sum != nil {
+			var err error
+			if data, partSum, err = u.readPart(file, offset, partSize, buffers, sum); err != nil {
+				<-sem
+				uploadErr.CompareAndSwap(nil, fmt.Errorf("cannot read part %d: %w", partNum, err))
+				break
+			}
+			body, bodyOffset = bytes.NewReader(data), 0
 		}
 
 		wg.Add(1)
-		sem <- struct{}{} // Acquire semaphore
-
-		go func(pNum int, pURL string, pOffset, pSize int64) {
+		go func(body io.ReaderAt, p partUpload, data []byte) {
 			defer wg.Done()
 			defer func() { <-sem }() // Release semaphore
+			if data != nil {
+				defer func() { buffers <- data[:cap(data)] }()
+			}
 
-			etag, err := u.uploadPart(ctx, file, pURL, pOffset, pSize, func(n int64) {
-				uploadedMu.Lock()
-				uploadedBytes += n
-				u.printProgress(uploadedBytes, size)
-				uploadedMu.Unlock()
-			})
+			etag, err := u.uploadPart(ctx, body, p, task)
 
 			if err != nil {
-				uploadErr.CompareAndSwap(nil, fmt.Errorf("part %d failed: %w", pNum, err))
+				uploadErr.CompareAndSwap(nil, fmt.Errorf("part %d failed: %w", p.number, err))
 				return
 			}
 
-			partsMu.Lock()
-			parts = append(parts, api.Part{
-				PartNumber: pNum,
+			part := api.Part{
+				PartNumber: p.number,
 				ETag:       etag,
-			})
+			}
+			partsMu.Lock()
+			parts = append(parts, part)
 			partsMu.Unlock()
-		}(partNum, url, offset, partSize)
+
+			if j != nil {
+				if err := j.addPart(part); err != nil {
+					u.log("Cannot update resume journal: %v\n", err)
+				}
+			}
+		}(body, u.newPartUpload(initResp.UploadID, partNum, url, bodyOffset, partSize, partSum), data)
 	}
 
 	wg.Wait()
-	fmt.Println() // newline after progress
 
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("upload cancelled")
@@ -489,29 +936,88 @@ func (u *Uploader) uploadMultipart(ctx context.Context, file *os.File, initResp
 	return nil
 }
 
-// uploadPart uploads a single part and returns its ETag
-func (u *Uploader) uploadPart(ctx context.Context, file *os.File, url string, offset, size int64, onProgress func(int64)) (string, error) {
+// readPart reads size bytes at offset into a buffer from buffers, or a new
+// one if none is free, and returns them with their checksum. sum is fed the
+// bytes too.
+func (u *Uploader) readPart(file io.ReaderAt, offset, size int64, buffers chan []byte, sum hash.Hash) ([]byte, hash.Hash, error) {
+	var buf []byte
+	select {
+	case buf = <-buffers:
+	default:
+	}
+	if int64(cap(buf)) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	if _, err := io.ReadFull(io.NewSectionReader(file, offset, size), buf); err != nil {
+		return nil, nil, err
+	}
+	partSum := u.newHash()
+	io.MultiWriter(sum, partSum).Write(buf)
+	return buf, partSum, nil
+}
+
+// partUpload is one part of a multipart upload
+type partUpload struct {
+	uploadID string
+	number   int
+	url      string
+	offset   int64
+	size     int64
+	// checksumHeader and checksum are sent with the part, if set
+	checksumHeader string
+	checksum       string
+}
+
+// newPartUpload describes a part. sum is the part's checksum, or nil.
+func (u *Uploader) newPartUpload(uploadID string, number int, url string, offset, size int64, sum hash.Hash) partUpload {
+	p := partUpload{uploadID: uploadID, number: number, url: url, offset: offset, size: size}
+	if sum != nil {
+		p.checksumHeader, p.checksum = u.checksumHeader(sum)
+	}
+	return p
+}
+
+// uploadPart uploads a single part and returns its ETag. Bytes sent are
+// added to task, and taken back again when an attempt fails.
+func (u *Uploader) uploadPart(ctx context.Context, file io.ReaderAt, p partUpload, task *progress.Task) (string, error) {
 	var etag string
+	url := p.url
+
+	err := u.withRetry(ctx, task, p.number, func() (err error) {
+		// Bytes of a failed attempt no longer count, they are sent again
+		var reported int64
+		defer func() {
+			if err != nil {
+				task.Add(-reported)
+			}
+		}()
 
-	err := u.uploadWithRetry(ctx, func() error {
 		// Create context with timeout
 		uploadCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 		defer cancel()
 
 		// Create section reader for this part
-		section := io.NewSectionReader(file, offset, size)
-
-		req, err := http.NewRequestWithContext(uploadCtx, "PUT", url, &progressReader{
-			reader:     section,
-			total:      size,
-			onProgress: func(uploaded, _ int64) { onProgress(uploaded) },
+		section := io.NewSectionReader(file, p.offset, p.size)
+
+		// Report byte deltas so progress sums up across parts
+		req, err := http.NewRequestWithContext(uploadCtx, "PUT", url, &progress.Reader{
+			Reader: u.limiter.Reader(uploadCtx, section),
+			Total:  p.size,
+			OnProgress: func(uploaded, _ int64) {
+				task.Add(uploaded - reported)
+				reported = uploaded
+			},
 		})
 		if err != nil {
-			return err
+			return retry.Permanent(err)
 		}
 
 		req.Header.Set("User-Agent", version.UserAgent())
-		req.ContentLength = size
+		if p.checksum != "" {
+			req.Header.Set(p.checksumHeader, p.checksum)
+		}
+		req.ContentLength = p.size
 
 		client := &http.Client{}
 		resp, err := client.Do(req)
@@ -524,8 +1030,19 @@ func (u *Uploader) uploadPart(ctx context.Context, file *os.File, url string, of
 		defer resp.Body.Close()
 
 		if resp.StatusCode >= 400 {
-			body, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("part upload failed (HTTP %d): %s", resp.StatusCode, string(body))
+			failure := putFailure(resp)
+			if resp.StatusCode != http.StatusForbidden {
+				return failure.retryError()
+			}
+
+			// Presigned URLs expire, e.g. when an upload is resumed much
+			// later, so try again with a fresh one
+			fresh, err := u.partURL(ctx, p.uploadID, p.number)
+			if err != nil {
+				return retry.Permanent(fmt.Errorf("%v; cannot get a new upload URL: %w", failure, err))
+			}
+			url = fresh
+			return failure
 		}
 
 		// Extract ETag from response
@@ -534,121 +1051,128 @@ func (u *Uploader) uploadPart(ctx context.Context, file *os.File, url string, of
 			return fmt.Errorf("server did not return ETag")
 		}
 
+		task.Event(progress.Event{Type: progress.PartCompleted, Part: p.number, Bytes: p.size})
 		return nil
 	})
 
 	return etag, err
 }
 
-// uploadWithRetry retries an upload function
-func (u *Uploader) uploadWithRetry(ctx context.Context, fn func() error) error {
-	var err error
-	for i := 0; i < maxRetries; i++ {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
+// partURL fetches a new presigned URL for one part of a multipart upload
+func (u *Uploader) partURL(ctx context.Context, uploadID string, partNum int) (string, error) {
+	resp, err := u.client.GetPartURLs(ctx, &api.GetPartURLsRequest{
+		UploadID:    uploadID,
+		PartNumbers: []int{partNum},
+	})
+	if err != nil {
+		return "", err
+	}
+	url, ok := resp.URLs[strconv.Itoa(partNum)]
+	if !ok {
+		return "", fmt.Errorf("no URL for part %d", partNum)
+	}
+	return url, nil
+}
 
-		err = fn()
-		if err == nil {
-			return nil
-		}
+// withRetry runs an upload step of task under the retry policy, logging
+// each retry. part is the part number the step sends, 0 for a whole file.
+func (u *Uploader) withRetry(ctx context.Context, task *progress.Task, part int, fn func() error) error {
+	policy := u.opts.Retry
+	policy.OnRetry = func(attempt int, err error, wait time.Duration) {
+		u.log("Retry %d/%d in %s: %v\n", attempt, policy.Attempts-1, wait.Round(100*time.Millisecond), err)
+		task.Event(progress.Event{
+			Type:        progress.Retry,
+			Part:        part,
+			Attempt:     attempt,
+			WaitSeconds: wait.Seconds(),
+			Error:       err.Error(),
+		})
+	}
+	return policy.Do(ctx, fn)
+}
 
-		if i < maxRetries-1 {
-			u.log("Retry %d/%d: %v\n", i+1, maxRetries-1, err)
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(retryDelay):
-			}
-		}
+// emitConfirmed reports that filename was confirmed as file
+func (u *Uploader) emitConfirmed(filename string, file *api.FileInfo) {
+	e := progress.Event{Type: progress.FileConfirmed, File: filename}
+	if file != nil {
+		e.URL = file.URL
 	}
-	return err
+	u.opts.Progress.Emit(e)
 }
 
-func (u *Uploader) log(format string, args ...interface{}) {
-	if u.verbose {
-		fmt.Printf(format, args...)
+// putError is a failed PUT to a presigned storage URL
+type putError struct {
+	StatusCode int
+	Body       string
+	retryAfter time.Duration
+}
+
+// putFailure reads the error response of a PUT
+func putFailure(resp *http.Response) *putError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	e := &putError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.retryAfter = time.Duration(secs) * time.Second
 	}
+	return e
 }
 
-func (u *Uploader) printProgress(uploaded, total int64) {
-	pct := float64(uploaded) / float64(total) * 100
-	fmt.Printf("\r  %s / %s (%.1f%%)  ", humanSize(uploaded), humanSize(total), pct)
+func (e *putError) Error() string {
+	return fmt.Sprintf("upload failed (HTTP %d): %s", e.StatusCode, e.Body)
 }
 
-// progressReader wraps a reader to track progress
-type progressReader struct {
-	reader     io.Reader
-	total      int64
-	uploaded   int64
-	onProgress func(uploaded, total int64)
+// RetryAfter returns the wait requested by the Retry-After header
+func (e *putError) RetryAfter() time.Duration {
+	return e.retryAfter
 }
 
-func (pr *progressReader) Read(p []byte) (int, error) {
-	n, err := pr.reader.Read(p)
-	if n > 0 {
-		pr.uploaded += int64(n)
-		if pr.onProgress != nil {
-			pr.onProgress(pr.uploaded, pr.total)
-		}
+// retryError returns e, marked permanent unless the failure is a timeout,
+// throttling or a server error that may go away on its own
+func (e *putError) retryError() error {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout,
+		e.StatusCode == http.StatusTooManyRequests,
+		e.StatusCode >= 500 && e.StatusCode != http.StatusNotImplemented:
+		return e
+	}
+	return retry.Permanent(e)
+}
+
+// filePassword returns the password for a file upload. Files in a
+// collection are protected by the collection's password.
+func (u *Uploader) filePassword(collectionID string) string {
+	if collectionID != "" {
+		return ""
+	}
+	return u.opts.Password
+}
+
+// checkPartSize reports when the server chose a part size for a multipart
+// upload other than the one asked for with Options.PartSize
+func (u *Uploader) checkPartSize(filename string, partSize int64) {
+	if u.opts.PartSize > 0 && partSize != u.opts.PartSize {
+		u.opts.Progress.Printf("%s: uploading in %s parts instead of %s\n", filename, progress.HumanSize(partSize), progress.HumanSize(u.opts.PartSize))
+	}
+}
+
+func (u *Uploader) log(format string, args ...interface{}) {
+	if u.opts.Verbose {
+		u.opts.Progress.Printf(format, args...)
+	}
+}
+
+// endTask marks task done, or failed if err is set
+func endTask(task *progress.Task, err error) {
+	if err != nil {
+		task.Fail(err)
+	} else {
+		task.Done()
 	}
-	return n, err
 }
 
 func detectContentType(path string, file *os.File) string {
 	// Try by extension first
-	ext := strings.ToLower(filepath.Ext(path))
-	mimeTypes := map[string]string{
-		".jpg":  "image/jpeg",
-		".jpeg": "image/jpeg",
-		".png":  "image/png",
-		".gif":  "image/gif",
-		".webp": "image/webp",
-		".svg":  "image/svg+xml",
-		".pdf":  "application/pdf",
-		".zip":  "application/zip",
-		".tar":  "application/x-tar",
-		".gz":   "application/gzip",
-		".tgz":  "application/gzip",
-		".bz2":  "application/x-bzip2",
-		".xz":   "application/x-xz",
-		".7z":   "application/x-7z-compressed",
-		".rar":  "application/vnd.rar",
-		".mp4":  "video/mp4",
-		".webm": "video/webm",
-		".mov":  "video/quicktime",
-		".avi":  "video/x-msvideo",
-		".mkv":  "video/x-matroska",
-		".mp3":  "audio/mpeg",
-		".wav":  "audio/wav",
-		".ogg":  "audio/ogg",
-		".flac": "audio/flac",
-		".txt":  "text/plain",
-		".md":   "text/markdown",
-		".json": "application/json",
-		".xml":  "application/xml",
-		".html": "text/html",
-		".css":  "text/css",
-		".js":   "application/javascript",
-		".ts":   "application/typescript",
-		".go":   "text/x-go",
-		".py":   "text/x-python",
-		".rb":   "text/x-ruby",
-		".rs":   "text/x-rust",
-		".c":    "text/x-c",
-		".cpp":  "text/x-c++",
-		".h":    "text/x-c",
-		".hpp":  "text/x-c++",
-		".java": "text/x-java",
-		".php":  "text/x-php",
-		".sh":   "application/x-sh",
-		".sql":  "application/sql",
-		".yml":  "application/x-yaml",
-		".yaml": "application/x-yaml",
-		".toml": "application/toml",
-	}
-
-	if mime, ok := mimeTypes[ext]; ok {
+	if mime, ok := contentTypeByExt(path); ok {
 		return mime
 	}
 
@@ -660,17 +1184,69 @@ func detectContentType(path string, file *os.File) string {
 	return http.DetectContentType(buf[:n])
 }
 
-func humanSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+// contentTypeByExt looks up the content type for a filename's extension
+func contentTypeByExt(name string) (string, bool) {
+	mime, ok := mimeTypes[strings.ToLower(filepath.Ext(name))]
+	return mime, ok
+}
+
+// mimeTypes maps common file extensions to content types
+var mimeTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+	".pdf":  "application/pdf",
+	".zip":  "application/zip",
+	".tar":  "application/x-tar",
+	".gz":   "application/gzip",
+	".tgz":  "application/gzip",
+	".bz2":  "application/x-bzip2",
+	".xz":   "application/x-xz",
+	".7z":   "application/x-7z-compressed",
+	".rar":  "application/vnd.rar",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".avi":  "video/x-msvideo",
+	".mkv":  "video/x-matroska",
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".flac": "audio/flac",
+	".txt":  "text/plain",
+	".md":   "text/markdown",
+	".json": "application/json",
+	".xml":  "application/xml",
+	".html": "text/html",
+	".css":  "text/css",
+	".js":   "application/javascript",
+	".ts":   "application/typescript",
+	".go":   "text/x-go",
+	".py":   "text/x-python",
+	".rb":   "text/x-ruby",
+	".rs":   "text/x-rust",
+	".c":    "text/x-c",
+	".cpp":  "text/x-c++",
+	".h":    "text/x-c",
+	".hpp":  "text/x-c++",
+	".java": "text/x-java",
+	".php":  "text/x-php",
+	".sh":   "application/x-sh",
+	".sql":  "application/sql",
+	".yml":  "application/x-yaml",
+	".yaml": "application/x-yaml",
+	".toml": "application/toml",
+}
+
+// partLength returns the size of a part; the last part may be smaller
+func partLength(partNum int, partSize int64, totalParts int, size int64) int64 {
+	if partNum == totalParts {
+		return size - int64(partNum-1)*partSize
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	return partSize
 }
 
 func generatePartNumbers(start, end int) []int {
@@ -681,9 +1257,27 @@ func generatePartNumbers(start, end int) []int {
 	return nums
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// pendingParts returns up to n part numbers from start to total that are
+// not done yet
+func pendingParts(start, total int, done map[int]bool, n int) []int {
+	var nums []int
+	for i := start; i <= total && len(nums) < n; i++ {
+		if !done[i] {
+			nums = append(nums, i)
+		}
+	}
+	return nums
+}
+
+// bound returns def for 0 and otherwise keeps v between 1 and max
+func bound(v, def, max int) int {
+	switch {
+	case v == 0:
+		return def
+	case v < 1:
+		return 1
+	case v > max:
+		return max
 	}
-	return b
+	return v
 }
@@ -1,33 +1,29 @@
 package upload
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
-)
-
-func TestHumanSize(t *testing.T) {
-	tests := []struct {
-		bytes int64
-		want  string
-	}{
-		{0, "0 B"},
-		{100, "100 B"},
-		{1023, "1023 B"},
-		{1024, "1.0 KB"},
-		{1536, "1.5 KB"},
-		{1048576, "1.0 MB"},
-		{1073741824, "1.0 GB"},
-		{1099511627776, "1.0 TB"},
-	}
 
-	for _, tt := range tests {
-		got := humanSize(tt.bytes)
-		if got != tt.want {
-			t.Errorf("humanSize(%d) = %q, want %q", tt.bytes, got, tt.want)
-		}
-	}
-}
+	"github.com/storageto/cli/internal/api"
+	"github.com/storageto/cli/internal/progress"
+	"github.com/storageto/cli/internal/retry"
+)
 
 func TestGeneratePartNumbers(t *testing.T) {
 	tests := []struct {
@@ -53,15 +49,37 @@ func TestGeneratePartNumbers(t *testing.T) {
 	}
 }
 
-func TestMin(t *testing.T) {
-	if min(1, 2) != 1 {
-		t.Error("min(1, 2) should be 1")
+func TestPendingParts(t *testing.T) {
+	done := map[int]bool{1: true, 3: true, 4: true}
+	if got := fmt.Sprint(pendingParts(1, 7, done, 3)); got != "[2 5 6]" {
+		t.Errorf("pendingParts(1, 7) = %s, want [2 5 6]", got)
 	}
-	if min(5, 3) != 3 {
-		t.Error("min(5, 3) should be 3")
+	if got := fmt.Sprint(pendingParts(6, 7, done, 3)); got != "[6 7]" {
+		t.Errorf("pendingParts(6, 7) = %s, want [6 7]", got)
 	}
-	if min(4, 4) != 4 {
-		t.Error("min(4, 4) should be 4")
+}
+
+func TestPartLength(t *testing.T) {
+	if got := partLength(1, 10, 3, 25); got != 10 {
+		t.Errorf("partLength(first) = %d, want 10", got)
+	}
+	if got := partLength(3, 10, 3, 25); got != 5 {
+		t.Errorf("partLength(last) = %d, want 5", got)
+	}
+}
+
+func TestBound(t *testing.T) {
+	tests := []struct{ v, want int }{
+		{0, 4},
+		{-1, 1},
+		{1, 1},
+		{16, 16},
+		{100, 32},
+	}
+	for _, tt := range tests {
+		if got := bound(tt.v, 4, 32); got != tt.want {
+			t.Errorf("bound(%d, 4, 32) = %d, want %d", tt.v, got, tt.want)
+		}
 	}
 }
 
@@ -101,3 +119,489 @@ func TestDetectContentType(t *testing.T) {
 		}
 	}
 }
+
+func TestPutErrorRetryable(t *testing.T) {
+	tests := []struct {
+		status    int
+		retryable bool
+	}{
+		{400, false},
+		{403, false},
+		{404, false},
+		{408, true},
+		{429, true},
+		{500, true},
+		{501, false},
+		{503, true},
+	}
+	for _, tt := range tests {
+		err := (&putError{StatusCode: tt.status}).retryError()
+		if retry.IsPermanent(err) == tt.retryable {
+			t.Errorf("HTTP %d: retryable = %v, want %v", tt.status, !tt.retryable, tt.retryable)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		alg    string
+		hex    string
+		header string
+	}{
+		{ChecksumSHA256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0="},
+		{ChecksumCRC32C, "364b3fb7", "Nks/tw=="},
+	}
+	for _, tt := range tests {
+		u := NewUploader(nil, Options{Checksum: tt.alg})
+		sum := u.newHash()
+		sum.Write([]byte("abc"))
+
+		if d := u.digest(sum); d.ChecksumAlgorithm != tt.alg || d.Checksum != tt.hex {
+			t.Errorf("%s: digest = %+v, want %s", tt.alg, d, tt.hex)
+		}
+		if name, value := u.checksumHeader(sum); name != "x-amz-checksum-"+tt.alg || value != tt.header {
+			t.Errorf("%s: header %s: %s, want %s", tt.alg, name, value, tt.header)
+		}
+	}
+
+	if NewUploader(nil, Options{}).newHash() != nil {
+		t.Error("newHash() without Options.Checksum should be nil")
+	}
+	if err := CheckChecksum("md5"); err == nil {
+		t.Error("CheckChecksum(md5) should fail")
+	}
+}
+
+// fakeServer is an in-memory storage.to API together with the storage
+// behind its presigned URLs. Uploads larger than partSize are multipart.
+type fakeServer struct {
+	*httptest.Server
+	partSize int64
+
+	mu         sync.Mutex
+	nextID     int
+	keys       map[string]string         // R2 key by upload ID
+	parts      map[string]map[int][]byte // Stored parts by upload ID
+	objects    map[string][]byte         // Stored content by R2 key
+	singlePuts []string                  // R2 keys sent in one PUT
+	partPuts   []int                     // Part numbers in the order received
+	partURLs   []int                     // Part numbers URLs were requested for
+	completed  []string                  // Upload IDs
+	aborted    []string                  // Upload IDs
+	checksums  int                       // PUTs with a SHA-256 checksum
+	digests    map[string]string         // Confirmed digests by filename
+	// onPart, if set, is called before a part is stored. A non-zero status
+	// is returned instead of storing it.
+	onPart func(number int) int
+}
+
+func newFakeServer(t *testing.T, partSize int64) *fakeServer {
+	s := &fakeServer{
+		partSize: partSize,
+		keys:     make(map[string]string),
+		parts:    make(map[string]map[int][]byte),
+		objects:  make(map[string][]byte),
+		digests:  make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, v interface{}) {
+		json.NewEncoder(w).Encode(v)
+	}
+	decode := func(r *http.Request, v interface{}) {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			t.Errorf("%s: cannot decode request: %v", r.URL.Path, err)
+		}
+	}
+
+	mux.HandleFunc("POST /api/upload/init", func(w http.ResponseWriter, r *http.Request) {
+		var req api.InitUploadRequest
+		decode(r, &req)
+		reply(w, s.init(req.Filename, req.Size, req.Streaming))
+	})
+	mux.HandleFunc("POST /api/upload/init-batch", func(w http.ResponseWriter, r *http.Request) {
+		var req api.InitBatchRequest
+		decode(r, &req)
+		resp := api.InitBatchResponse{Success: true, Results: make(map[string]api.InitBatchResult)}
+		for i, f := range req.Files {
+			init := s.init(f.Filename, f.Size, false)
+			resp.Results[strconv.Itoa(i)] = api.InitBatchResult{
+				Success:     true,
+				Type:        init.Type,
+				UploadURL:   init.UploadURL,
+				R2Key:       init.R2Key,
+				UploadID:    init.UploadID,
+				PartSize:    init.PartSize,
+				TotalParts:  init.TotalParts,
+				InitialURLs: init.InitialURLs,
+			}
+		}
+		reply(w, resp)
+	})
+	mux.HandleFunc("POST /api/upload/parts", func(w http.ResponseWriter, r *http.Request) {
+		var req api.GetPartURLsRequest
+		decode(r, &req)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.keys[req.UploadID]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			reply(w, map[string]interface{}{"success": false, "error": "Upload not found"})
+			return
+		}
+		s.partURLs = append(s.partURLs, req.PartNumbers...)
+		urls := make(map[string]string)
+		for _, n := range req.PartNumbers {
+			urls[strconv.Itoa(n)] = s.partURL(req.UploadID, n)
+		}
+		reply(w, api.GetPartURLsResponse{Success: true, URLs: urls})
+	})
+	mux.HandleFunc("PUT /put/{key}", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if !s.checkSum(w, r, data) {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.singlePuts = append(s.singlePuts, r.PathValue("key"))
+		s.objects[r.PathValue("key")] = data
+	})
+	mux.HandleFunc("PUT /part/{id}/{number}", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		data, _ := io.ReadAll(r.Body)
+		if !s.checkSum(w, r, data) {
+			return
+		}
+		if s.onPart != nil {
+			if status := s.onPart(number); status != 0 {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.partPuts = append(s.partPuts, number)
+		s.parts[r.PathValue("id")][number] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+	})
+	mux.HandleFunc("POST /api/upload/complete-multipart", func(w http.ResponseWriter, r *http.Request) {
+		var req api.CompleteMultipartRequest
+		decode(r, &req)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sort.Slice(req.Parts, func(i, j int) bool { return req.Parts[i].PartNumber < req.Parts[j].PartNumber })
+		var data []byte
+		for i, p := range req.Parts {
+			if p.PartNumber != i+1 || p.ETag != fmt.Sprintf("etag-%d", p.PartNumber) {
+				reply(w, api.CompleteMultipartResponse{Error: fmt.Sprintf("bad part %+v", p)})
+				return
+			}
+			data = append(data, s.parts[req.UploadID][p.PartNumber]...)
+		}
+		s.objects[s.keys[req.UploadID]] = data
+		s.completed = append(s.completed, req.UploadID)
+		reply(w, api.CompleteMultipartResponse{Success: true})
+	})
+	mux.HandleFunc("POST /api/upload/abort", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			UploadID string `json:"upload_id"`
+		}
+		decode(r, &req)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.aborted = append(s.aborted, req.UploadID)
+		reply(w, map[string]bool{"success": true})
+	})
+	mux.HandleFunc("POST /api/upload/confirm", func(w http.ResponseWriter, r *http.Request) {
+		var req api.ConfirmUploadRequest
+		decode(r, &req)
+		s.mu.Lock()
+		s.digests[req.Filename] = req.Checksum
+		s.mu.Unlock()
+		reply(w, api.ConfirmUploadResponse{Success: true, File: s.file(req.Filename, req.R2Key, req.Size)})
+	})
+	mux.HandleFunc("POST /api/upload/confirm-batch", func(w http.ResponseWriter, r *http.Request) {
+		var req api.ConfirmBatchRequest
+		decode(r, &req)
+		resp := api.ConfirmBatchResponse{Success: true, Results: make(map[string]api.ConfirmBatchResult)}
+		for i, f := range req.Files {
+			s.mu.Lock()
+			s.digests[f.Filename] = f.Checksum
+			s.mu.Unlock()
+			resp.Results[strconv.Itoa(i)] = api.ConfirmBatchResult{Success: true, File: s.file(f.Filename, f.R2Key, f.Size)}
+		}
+		reply(w, resp)
+	})
+	mux.HandleFunc("POST /api/collection", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, api.CreateCollectionResponse{Success: true, Collection: &api.CollectionInfo{ID: "C1"}})
+	})
+	mux.HandleFunc("POST /api/collection/{id}/ready", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, api.MarkCollectionReadyResponse{Success: true, Collection: &api.CollectionInfo{ID: r.PathValue("id")}})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// init starts an upload. Only the URL of the first part comes with a
+// multipart upload, the others have to be requested.
+func (s *fakeServer) init(filename string, size int64, streaming bool) api.InitUploadResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	key := "key" + id
+	if !streaming && size <= s.partSize {
+		return api.InitUploadResponse{Success: true, Type: "single", UploadURL: s.URL + "/put/" + key, R2Key: key}
+	}
+
+	s.keys[id] = key
+	s.parts[id] = make(map[int][]byte)
+	resp := api.InitUploadResponse{
+		Success:     true,
+		Type:        "multipart",
+		UploadID:    id,
+		R2Key:       key,
+		PartSize:    s.partSize,
+		InitialURLs: map[string]string{"1": s.partURL(id, 1)},
+	}
+	if !streaming {
+		resp.TotalParts = int((size + s.partSize - 1) / s.partSize)
+	}
+	return resp
+}
+
+// checkSum rejects a PUT with an x-amz-checksum-sha256 header that doesn't
+// match data like storage does, reporting whether it was accepted
+func (s *fakeServer) checkSum(w http.ResponseWriter, r *http.Request, data []byte) bool {
+	header := r.Header.Get("x-amz-checksum-sha256")
+	if header == "" {
+		return true
+	}
+	sum := sha256.Sum256(data)
+	if header != base64.StdEncoding.EncodeToString(sum[:]) {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checksums++
+	return true
+}
+
+func (s *fakeServer) partURL(uploadID string, number int) string {
+	return fmt.Sprintf("%s/part/%s/%d", s.URL, uploadID, number)
+}
+
+func (s *fakeServer) file(filename, key string, size int64) *api.FileInfo {
+	return &api.FileInfo{ID: key, URL: s.URL + "/f/" + key, Filename: filename, Size: size}
+}
+
+// testUploader returns an Uploader for s that doesn't retry
+func testUploader(s *fakeServer, opts Options) *Uploader {
+	opts.Retry = retry.Policy{Attempts: 1}
+	return NewUploader(api.NewClient(s.URL, ""), opts)
+}
+
+func TestUploadFilesBatchMultipart(t *testing.T) {
+	s := newFakeServer(t, 10)
+
+	dir := t.TempDir()
+	small := []byte("small")
+	big := []byte("a file that takes three parts")
+	os.WriteFile(filepath.Join(dir, "small.txt"), small, 0644)
+	os.WriteFile(filepath.Join(dir, "big.bin"), big, 0644)
+
+	u := testUploader(s, Options{})
+	result, err := u.UploadFiles(context.Background(), []File{
+		{Path: filepath.Join(dir, "small.txt")},
+		{Path: filepath.Join(dir, "big.bin")},
+	}, true)
+	if err != nil {
+		t.Fatalf("UploadFiles() error = %v", err)
+	}
+	if !result.IsCollection || result.Collection.ID != "C1" {
+		t.Errorf("result = %+v, want collection C1", result)
+	}
+
+	// big.bin is initialized second, as upload 2
+	if len(s.completed) != 1 || s.completed[0] != "2" {
+		t.Errorf("completed uploads = %v, want big.bin's", s.completed)
+	}
+	if len(s.singlePuts) != 1 || s.singlePuts[0] != "key1" {
+		t.Errorf("single PUTs = %v, want only small.txt's", s.singlePuts)
+	}
+	if got := s.objects["key2"]; !bytes.Equal(got, big) {
+		t.Errorf("stored big.bin = %q, want %q", got, big)
+	}
+	if got := s.objects["key1"]; !bytes.Equal(got, small) {
+		t.Errorf("stored small.txt = %q, want %q", got, small)
+	}
+}
+
+func TestUploadFilePartSizeAdjusted(t *testing.T) {
+	s := newFakeServer(t, 10)
+	path := filepath.Join(t.TempDir(), "big.bin")
+	os.WriteFile(path, []byte("a file that takes three parts"), 0644)
+
+	var out bytes.Buffer
+	display := progress.New(&out, progress.Plain)
+	u := testUploader(s, Options{PartSize: 20, Progress: display})
+	_, err := u.UploadFiles(context.Background(), []File{{Path: path}}, false)
+	display.Stop()
+	if err != nil {
+		t.Fatalf("UploadFiles() error = %v", err)
+	}
+	if want := "big.bin: uploading in 10 B parts instead of 20 B\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("output = %q, want it to report the part size in effect", out.String())
+	}
+}
+
+// countingReaderAt counts the bytes read from it
+type countingReaderAt struct {
+	r io.ReaderAt
+	n atomic.Int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func TestUploadChecksums(t *testing.T) {
+	s := newFakeServer(t, 10)
+
+	dir := t.TempDir()
+	small := []byte("small")
+	big := []byte("a file that takes three parts")
+	os.WriteFile(filepath.Join(dir, "small.txt"), small, 0644)
+	os.WriteFile(filepath.Join(dir, "big.bin"), big, 0644)
+
+	u := testUploader(s, Options{Checksum: ChecksumSHA256})
+	_, err := u.UploadFiles(context.Background(), []File{
+		{Path: filepath.Join(dir, "small.txt")},
+		{Path: filepath.Join(dir, "big.bin")},
+	}, true)
+	if err != nil {
+		t.Fatalf("UploadFiles() error = %v", err)
+	}
+
+	// One single PUT and three parts, each with its checksum
+	if s.checksums != 4 {
+		t.Errorf("%d PUTs had a checksum, want 4", s.checksums)
+	}
+	for name, content := range map[string][]byte{"small.txt": small, "big.bin": big} {
+		sum := sha256.Sum256(content)
+		if got := s.digests[name]; got != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s confirmed with digest %q, want %x", name, got, sum)
+		}
+	}
+}
+
+func TestUploadMultipartReadsOnce(t *testing.T) {
+	s := newFakeServer(t, 10)
+	data := []byte("a file that takes three parts")
+	initResp := s.init("big.bin", int64(len(data)), false)
+
+	u := testUploader(s, Options{Checksum: ChecksumSHA256, ConcurrentParts: 2})
+	file := &countingReaderAt{r: bytes.NewReader(data)}
+	sum := u.newHash()
+	if err := u.uploadMultipart(context.Background(), file, &initResp, int64(len(data)), nil, sum, nil); err != nil {
+		t.Fatalf("uploadMultipart() error = %v", err)
+	}
+	if got := file.n.Load(); got != int64(len(data)) {
+		t.Errorf("read %d bytes, want each of the %d read once", got, len(data))
+	}
+	if s.checksums != 3 {
+		t.Errorf("%d parts had a checksum, want 3", s.checksums)
+	}
+	if got := s.objects[initResp.R2Key]; !bytes.Equal(got, data) {
+		t.Errorf("stored %q, want %q", got, data)
+	}
+}
+
+func TestUploadSingleReadsOnce(t *testing.T) {
+	s := newFakeServer(t, 100)
+	data := []byte("a file sent in one request")
+	initResp := s.init("small.txt", int64(len(data)), false)
+	if initResp.Type != "single" {
+		t.Fatalf("upload type = %q, want single", initResp.Type)
+	}
+
+	u := testUploader(s, Options{Checksum: ChecksumSHA256})
+	file := &countingReaderAt{r: bytes.NewReader(data)}
+	sum := u.newHash()
+	err := u.uploadSingle(context.Background(), io.NewSectionReader(file, 0, int64(len(data))), initResp.UploadURL, "text/plain", int64(len(data)), sum, nil)
+	if err != nil {
+		t.Fatalf("uploadSingle() error = %v", err)
+	}
+	if got := file.n.Load(); got != int64(len(data)) {
+		t.Errorf("read %d bytes, want each of the %d read once", got, len(data))
+	}
+	if s.checksums != 1 {
+		t.Errorf("%d PUTs had a checksum, want 1", s.checksums)
+	}
+	if got := s.objects[initResp.R2Key]; !bytes.Equal(got, data) {
+		t.Errorf("stored %q, want %q", got, data)
+	}
+}
+
+func TestUploadFilesBatchCancelAborts(t *testing.T) {
+	s := newFakeServer(t, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Ctrl+C while the first file is being sent
+	s.onPart = func(int) int {
+		cancel()
+		return 0
+	}
+
+	dir := t.TempDir()
+	var files []File
+	for _, name := range []string{"a.bin", "b.bin", "c.bin"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("a file that takes three parts"), 0644)
+		files = append(files, File{Path: path})
+	}
+
+	u := testUploader(s, Options{ConcurrentFiles: 1})
+	if _, err := u.UploadFiles(ctx, files, true); err == nil {
+		t.Fatal("UploadFiles() succeeded after cancel")
+	}
+
+	// The file in flight aborts itself, the others are aborted unsent
+	sort.Strings(s.aborted)
+	if got := fmt.Sprint(s.aborted); got != "[1 2 3]" {
+		t.Errorf("aborted uploads = %s, want [1 2 3] once each", got)
+	}
+	if len(s.completed) != 0 {
+		t.Errorf("completed uploads = %v, want none", s.completed)
+	}
+}
+
+func TestUploadFilesBatchFailedPartAborts(t *testing.T) {
+	s := newFakeServer(t, 10)
+	s.onPart = func(number int) int {
+		if number == 2 {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "small.txt"), []byte("small"), 0644)
+	os.WriteFile(filepath.Join(dir, "big.bin"), []byte("a file that takes three parts"), 0644)
+
+	u := testUploader(s, Options{})
+	_, err := u.UploadFiles(context.Background(), []File{
+		{Path: filepath.Join(dir, "small.txt")},
+		{Path: filepath.Join(dir, "big.bin")},
+	}, true)
+	if err != nil {
+		t.Fatalf("UploadFiles() error = %v", err)
+	}
+	if fmt.Sprint(s.aborted) != "[2]" {
+		t.Errorf("aborted uploads = %v, want big.bin's", s.aborted)
+	}
+}